@@ -0,0 +1,179 @@
+package bench
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/bench"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// passwordEnv 通过环境变量传入密码，避免出现在进程列表中
+const passwordEnv = "LFS_S3_BENCH_PASSWORD"
+
+var (
+	url         string
+	repoPrefix  string
+	repos       int
+	operation   string
+	objects     int
+	objectSize  int64
+	concurrency int
+	duration    time.Duration
+	requests    int64
+	transfer    bool
+	pool        int
+	username    string
+	password    string
+	certFile    string
+	keyFile     string
+	caFile      string
+	insecure    bool
+	StartCmd    = &cobra.Command{
+		Use:   "bench",
+		Short: "Load test the batch endpoint of a running server",
+		Long: "Send synthetic batch requests to a running server and report throughput and latency\n" +
+			"percentiles of the batch requests, the authentication measured by the server (taken from the\n" +
+			"Server-Timing response header) and, with --transfer, the object transfers. Requests are\n" +
+			"spread over --repos repositories named <repo-prefix>-<n>. The password can also be provided\n" +
+			"with the " + passwordEnv + " environment variable.",
+		Example: "lfs-s3 bench --url https://lfs.example.com/lfs --repo-prefix bench/repo --repos 10 \\\n" +
+			"    --operation mixed --objects 20 --concurrency 16 --duration 1m --transfer -u <username>",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := bench.Options{
+				URL:         strings.TrimSuffix(url, "/"),
+				Operation:   operation,
+				Objects:     objects,
+				ObjectSize:  objectSize,
+				Concurrency: concurrency,
+				Duration:    duration,
+				Requests:    requests,
+				Transfer:    transfer,
+				PoolSize:    pool,
+				Username:    username,
+				Password:    password,
+			}
+			if opts.URL == "" {
+				return errors.New("--url is required")
+			}
+			if opts.Password == "" {
+				opts.Password = os.Getenv(passwordEnv)
+			}
+			for i := range max(repos, 1) {
+				name := repoPrefix
+				if repos > 1 {
+					name += "-" + strconv.Itoa(i)
+				}
+				r, err := repo.Parse(name)
+				if err != nil {
+					return errors.Wrapf(err, "parse repo %q", name)
+				}
+				opts.Repos = append(opts.Repos, r)
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			opts.Client = client
+
+			cmd.SilenceUsage = true
+			// 中断时停止发起新的请求并输出已完成部分的统计
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			report, err := bench.Run(ctx, opts)
+			if report != nil {
+				printReport(report)
+			}
+			if errors.Is(err, context.Canceled) {
+				return errors.New("interrupted, the results above are partial")
+			}
+			return err
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVar(&url, "url", "", "LFS endpoint of the server including the base path, e.g. https://lfs.example.com/lfs")
+	StartCmd.PersistentFlags().StringVar(&repoPrefix, "repo-prefix", "bench/repo", "Repository to send requests to, suffixed with -<n> when --repos is greater than 1")
+	StartCmd.PersistentFlags().IntVar(&repos, "repos", 1, "Number of repositories to spread requests over")
+	StartCmd.PersistentFlags().StringVar(&operation, "operation", bench.OperationDownload, "Batch operation: upload, download or mixed")
+	StartCmd.PersistentFlags().IntVar(&objects, "objects", 10, "Number of objects per batch request")
+	StartCmd.PersistentFlags().Int64Var(&objectSize, "object-size", 1024, "Size of generated objects in bytes")
+	StartCmd.PersistentFlags().IntVar(&concurrency, "concurrency", 4, "Number of concurrent batch requests")
+	StartCmd.PersistentFlags().DurationVar(&duration, "duration", 30*time.Second, "Stop sending new batch requests after provided duration")
+	StartCmd.PersistentFlags().Int64Var(&requests, "requests", 0, "Stop after provided number of batch requests; 0 for no limit")
+	StartCmd.PersistentFlags().BoolVar(&transfer, "transfer", false, "Upload or download the objects through the returned actions")
+	StartCmd.PersistentFlags().IntVar(&pool, "pool", 0, "Number of objects generated before the run starts and reused in turn; 0 to size it from --requests and --concurrency")
+	StartCmd.PersistentFlags().StringVarP(&username, "username", "u", "", "Username for the forge")
+	StartCmd.PersistentFlags().StringVarP(&password, "password", "p", "", "Password or token for the forge")
+	StartCmd.PersistentFlags().StringVar(&certFile, "cert", "", "Client certificate for mutual TLS")
+	StartCmd.PersistentFlags().StringVar(&keyFile, "key", "", "Client key for mutual TLS")
+	StartCmd.PersistentFlags().StringVar(&caFile, "ca", "", "CA certificate to verify the server with")
+	StartCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "Skip verifying the server certificate")
+}
+
+func newClient() (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificate found in ca")
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	transport.MaxIdleConnsPerHost = max(concurrency, 1) * 2
+	return &http.Client{Transport: transport}, nil
+}
+
+func printReport(report *bench.Report) {
+	seconds := report.Elapsed.Seconds()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "phase\tcount\terrors\tskipped\tops/s\tMiB/s\tp50\tp90\tp99\tmax\t")
+	for _, phase := range bench.Phases {
+		s := report.Phases[phase]
+		if s.Count == 0 && s.Skipped == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f\t%.2f\t%s\t%s\t%s\t%s\t\n", phase, s.Count, s.Errors, s.Skipped,
+			float64(s.Count)/seconds, float64(s.Bytes)/seconds/(1<<20),
+			round(s.Percentile(50)), round(s.Percentile(90)), round(s.Percentile(99)), round(s.Percentile(100)))
+	}
+	_ = w.Flush()
+	fmt.Printf("elapsed %s\n", round(report.Elapsed))
+	for _, phase := range bench.Phases {
+		if s := report.Phases[phase]; s.LastError != "" {
+			fmt.Printf("last %s error: %s\n", phase, s.LastError)
+		}
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -19,7 +19,7 @@ var (
 	StartCmd   = &cobra.Command{
 		Use:     "config",
 		Short:   "Generate config file",
-		Example: "LarkPlus config -p ./config.yaml -f",
+		Example: "lfs-s3 config -p ./config.yaml -f",
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println("Generating config...")
 			err := GenYamlConfig(configPath, forceGen)
@@ -32,8 +32,9 @@ var (
 )
 
 func init() {
-	StartCmd.PersistentFlags().StringVarP(&configPath, "path", "p", "./config.yaml", "Generate config in provided path")
-	StartCmd.PersistentFlags().BoolVarP(&forceGen, "force", "f", false, "Force generate config in provided path")
+	StartCmd.Flags().StringVarP(&configPath, "path", "p", "./config.yaml", "Generate config in provided path")
+	StartCmd.Flags().BoolVarP(&forceGen, "force", "f", false, "Force generate config in provided path")
+	StartCmd.AddCommand(validateCmd, showCmd)
 }
 
 func GenYamlConfig(path string, force bool) error {
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"github.com/asjdf/lfs-s3/cmd/server/modList"
+	"github.com/asjdf/lfs-s3/pkg/envconf"
+	"github.com/juanjiTech/jframe/conf"
+	"github.com/juanjiTech/jframe/core/kernel"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Validator 由需要校验配置的模块的配置实现
+type Validator interface {
+	Validate() []error
+}
+
+// loadConfig 与服务一致地读取配置文件并应用环境变量，返回全局配置与填充好配置的模块
+func loadConfig(path string) (*conf.GlobalConfig, []kernel.Module, error) {
+	v := viper.New()
+	if path == "" {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("./config")
+	} else {
+		v.SetConfigFile(path)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, nil, errors.Wrap(err, "read config")
+	}
+
+	if err := envconf.ApplyModules(v, modList.ModList...); err != nil {
+		return nil, nil, err
+	}
+
+	global := &conf.GlobalConfig{}
+	if err := v.Unmarshal(global); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshal config")
+	}
+	var mods []kernel.Module
+	for _, mod := range modList.ModList {
+		if mod.Config() == nil {
+			continue
+		}
+		if err := v.UnmarshalKey(mod.Name(), mod.Config()); err != nil {
+			return nil, nil, errors.Wrapf(err, "unmarshal %s config", mod.Name())
+		}
+		mods = append(mods, mod)
+	}
+	return global, mods, nil
+}
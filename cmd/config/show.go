@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted 替换敏感配置项的值
+const Redacted = "<redacted>"
+
+// secretKeys 需要隐藏的配置项
+var secretKeys = map[string]struct{}{
+	"secretAccessKey": {},
+	"accessKey":       {},
+	"accessToken":     {},
+	"token":           {},
+	"sentryDsn":       {},
+}
+
+var (
+	showPath string
+	showCmd  = &cobra.Command{
+		Use:     "show",
+		Short:   "Print the effective config with secrets redacted",
+		Example: "lfs-s3 config show -c ./config.yaml",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			global, mods, err := loadConfig(showPath)
+			if err != nil {
+				return err
+			}
+
+			var doc yaml.Node
+			if err := doc.Encode(global); err != nil {
+				return errors.Wrap(err, "encode config")
+			}
+			for _, mod := range mods {
+				var key, value yaml.Node
+				key.SetString(mod.Name())
+				if err := value.Encode(mod.Config()); err != nil {
+					return errors.Wrapf(err, "encode %s config", mod.Name())
+				}
+				doc.Content = append(doc.Content, &key, &value)
+			}
+			redact(&doc)
+
+			data, err := yaml.Marshal(&doc)
+			if err != nil {
+				return errors.Wrap(err, "encode config")
+			}
+			fmt.Print(string(data))
+			return nil
+		},
+	}
+)
+
+func init() {
+	showCmd.Flags().StringVarP(&showPath, "config", "c", "", "Show provided configuration file")
+}
+
+// IsSecret 判断配置键是否为需要隐藏的敏感配置项
+func IsSecret(key string) bool {
+	_, ok := secretKeys[key]
+	return ok
+}
+
+// redact 隐藏所有非空的敏感配置项
+func redact(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if IsSecret(key.Value) && value.Kind == yaml.ScalarNode && value.Value != "" {
+				value.SetString(Redacted)
+			}
+		}
+	}
+	for _, c := range n.Content {
+		redact(c)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/healthcheck"
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/checker"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/auth"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/juanjiTech/jframe/conf"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// onlineCheckTimeout 联网检查的默认超时
+const onlineCheckTimeout = 5 * time.Second
+
+var (
+	validatePath string
+	online       bool
+	validateCmd  = &cobra.Command{
+		Use:   "validate",
+		Short: "Check a config file and report every problem found",
+		Long: "Load the config file the same way the server does and check required fields, URLs and\n" +
+			"module specific settings. With --online the S3 bucket, presigning and the forge are probed too.",
+		Example: "lfs-s3 config validate -c ./config.yaml --online",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			global, mods, err := loadConfig(validatePath)
+			if err != nil {
+				return err
+			}
+
+			problems := ValidateGlobal(global)
+			for _, mod := range mods {
+				v, ok := mod.Config().(Validator)
+				if !ok {
+					continue
+				}
+				for _, err := range v.Validate() {
+					problems = append(problems, errors.Errorf("%s.%v", mod.Name(), err))
+				}
+			}
+			if len(problems) > 0 {
+				for _, p := range problems {
+					fmt.Printf("  - %v\n", p)
+				}
+				return errors.Errorf("%d problems found", len(problems))
+			}
+			fmt.Println("config is valid")
+
+			if !online {
+				return nil
+			}
+			return checkOnline(cmd.Context())
+		},
+	}
+)
+
+func init() {
+	validateCmd.Flags().StringVarP(&validatePath, "config", "c", "", "Validate provided configuration file")
+	validateCmd.Flags().BoolVar(&online, "online", false, "Also probe the S3 bucket, presigning and the forge")
+}
+
+// ValidateGlobal 检查全局配置
+func ValidateGlobal(c *conf.GlobalConfig) []error {
+	var errs []error
+	if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, errors.Errorf("port: %q must be a number between 1 and 65535", c.Port))
+	}
+	switch c.MODE {
+	case "debug", "release", "test":
+	default:
+		errs = append(errs, errors.Errorf("mode: %q is not one of debug, release, test", c.MODE))
+	}
+	return errs
+}
+
+// checkOnline 执行与就绪检查相同的检查
+func checkOnline(ctx context.Context) error {
+	config, err := lfsS3.LoadConfig(validatePath)
+	if err != nil {
+		return err
+	}
+	s, err := storage.NewS3Storage(config.S3)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, c := range []healthcheck.Checker{
+		checker.NewBucket(s),
+		checker.NewPresign(s),
+		checker.NewForge(auth.ForgeURL),
+	} {
+		timeout := onlineCheckTimeout
+		if t, ok := c.(healthcheck.TimeoutChecker); ok {
+			timeout = t.Timeout()
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := c.Check(checkCtx)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Printf("  - %s: %v\n", c.Name(), err)
+			continue
+		}
+		fmt.Printf("  - %s: ok\n", c.Name())
+	}
+	if failed > 0 {
+		return errors.Errorf("%d online checks failed", failed)
+	}
+	return nil
+}
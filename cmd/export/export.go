@@ -0,0 +1,86 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/archive"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configPath string
+	repoPath   string
+	outputPath string
+	compress   bool
+	verbose    bool
+	StartCmd   = &cobra.Command{
+		Use:   "export",
+		Short: "Export the LFS objects of a repository into a tar archive",
+		Long: "Stream every object of a repository into a tar archive, preceded by a manifest of OIDs and\n" +
+			"sizes. The archive can be restored into any bucket with the import command.",
+		Example: "lfs-s3 export -c ./config.yaml -r owner/repo -o repo.tar.zst",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := repo.Parse(repoPath)
+			if err != nil {
+				return errors.Wrapf(err, "parse repo %q", repoPath)
+			}
+			config, err := lfsS3.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			s, err := storage.NewS3Storage(config.S3)
+			if err != nil {
+				return err
+			}
+			layout, err := handler.NewLayout(config.Layout, config.S3, s)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if outputPath != "" && outputPath != "-" {
+				f, err := os.Create(outputPath)
+				if err != nil {
+					return errors.Wrap(err, "create archive")
+				}
+				defer f.Close()
+				w = f
+				// 根据扩展名自动启用压缩
+				if strings.HasSuffix(outputPath, ".zst") || strings.HasSuffix(outputPath, ".tzst") {
+					compress = true
+				}
+			}
+
+			opts := archive.ExportOptions{Repo: r, Layout: layout, Compress: compress}
+			if verbose {
+				opts.OnObject = func(obj archive.Object) {
+					fmt.Fprintf(os.Stderr, "%s %d\n", obj.OID, obj.Size)
+				}
+			}
+			result, err := archive.Export(cmd.Context(), s, w, opts)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "exported %d objects (%d bytes) from %s\n", result.Objects, result.Bytes, r)
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Read storage settings from provided configuration file")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Repository to export, e.g. owner/repo")
+	StartCmd.PersistentFlags().StringVarP(&outputPath, "output", "o", "-", "Write the archive to provided file, - for stdout")
+	StartCmd.PersistentFlags().BoolVar(&compress, "zstd", false, "Compress the archive with zstd, enabled automatically for .zst and .tzst files")
+	StartCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print every exported object to stderr")
+	_ = StartCmd.MarkPersistentFlagRequired("repo")
+}
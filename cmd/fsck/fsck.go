@@ -0,0 +1,123 @@
+package fsck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/fsck"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configPath       string
+	repoPath         string
+	parallel         int
+	limitRate        string
+	reportPath       string
+	quarantine       bool
+	quarantinePrefix string
+	StartCmd         = &cobra.Command{
+		Use:   "fsck",
+		Short: "Re-hash stored objects and report corrupted ones",
+		Long: "Stream every object of a repository (or the whole bucket) through SHA-256 and compare it\n" +
+			"with the OID in its key. Problems are written to the report as JSON Lines and the command\n" +
+			"exits with a non-zero status when any is found.",
+		Example: "lfs-s3 fsck -c ./config.yaml -r owner/repo --parallel 8 --limit-rate 50M --report fsck.jsonl",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := fsck.Options{Parallel: parallel}
+			if repoPath != "" {
+				r, err := repo.Parse(repoPath)
+				if err != nil {
+					return errors.Wrapf(err, "parse repo %q", repoPath)
+				}
+				opts.Repo = &r
+			}
+			rate, err := parseBytes(limitRate)
+			if err != nil {
+				return errors.Wrapf(err, "parse limit rate %q", limitRate)
+			}
+			opts.BytesPerSecond = rate
+			if quarantine {
+				opts.QuarantinePrefix = quarantinePrefix
+			}
+
+			config, err := lfsS3.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			s, err := storage.NewS3Storage(config.S3)
+			if err != nil {
+				return err
+			}
+			if opts.Layout, err = storage.ParseLayout(config.Layout.Name); err != nil {
+				return err
+			}
+
+			var report io.Writer = os.Stdout
+			if reportPath != "" && reportPath != "-" {
+				f, err := os.Create(reportPath)
+				if err != nil {
+					return errors.Wrap(err, "create report")
+				}
+				defer f.Close()
+				report = f
+			}
+			encoder := json.NewEncoder(report)
+			opts.OnFinding = func(f fsck.Finding) {
+				_ = encoder.Encode(f)
+			}
+
+			result, err := fsck.Run(cmd.Context(), s, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "checked %d objects (%d bytes), %d problems, %d quarantined\n",
+				result.Objects, result.Bytes, result.Problems, result.Quarantined)
+			if result.Problems > 0 {
+				cmd.SilenceUsage = true
+				return errors.Errorf("%d problems found", result.Problems)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Read storage settings from provided configuration file")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Only check the provided repository, e.g. owner/repo; checks every object of the configured layout if empty")
+	StartCmd.PersistentFlags().IntVar(&parallel, "parallel", 4, "Number of objects to check concurrently")
+	StartCmd.PersistentFlags().StringVar(&limitRate, "limit-rate", "0", "Total read bandwidth limit in bytes per second, accepts K, M and G suffixes; 0 for unlimited")
+	StartCmd.PersistentFlags().StringVar(&reportPath, "report", "-", "Write the JSON Lines report to provided file, - for stdout")
+	StartCmd.PersistentFlags().BoolVar(&quarantine, "quarantine", false, "Move corrupted objects under the quarantine prefix")
+	StartCmd.PersistentFlags().StringVar(&quarantinePrefix, "quarantine-prefix", fsck.DefaultQuarantinePrefix, "Key prefix for quarantined objects")
+}
+
+// parseBytes 解析带 K、M、G 后缀（1024 进制）的字节数
+func parseBytes(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid byte size")
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,99 @@
+package gc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/gc"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// passwordEnv 通过环境变量传入密码，避免出现在进程列表中
+const passwordEnv = "LFS_S3_GIT_PASSWORD"
+
+var (
+	configPath  string
+	repoPath    string
+	repoURL     string
+	dir         string
+	username    string
+	password    string
+	gracePeriod time.Duration
+	dryRun      bool
+	StartCmd    = &cobra.Command{
+		Use:   "gc",
+		Short: "Delete LFS objects no longer referenced by repository history",
+		Long: "Clone or fetch the repository, walk all refs to collect LFS pointers and delete objects\n" +
+			"under the repository prefix that are no longer referenced. The password can also be\n" +
+			"provided with the " + passwordEnv + " environment variable.",
+		Example: "lfs-s3 gc -c ./config.yaml -r owner/repo --dry-run",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := repo.Parse(repoPath)
+			if err != nil {
+				return errors.Wrapf(err, "parse repo %q", repoPath)
+			}
+			config, err := lfsS3.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			s, err := storage.NewS3Storage(config.S3)
+			if err != nil {
+				return err
+			}
+			layout, err := storage.ParseLayout(config.Layout.Name)
+			if err != nil {
+				return err
+			}
+			if password == "" {
+				password = os.Getenv(passwordEnv)
+			}
+
+			action := "delete"
+			if dryRun {
+				action = "orphan"
+			}
+			result, err := gc.Run(cmd.Context(), s, gc.Options{
+				Repo:        r,
+				Layout:      layout,
+				URL:         repoURL,
+				Dir:         dir,
+				Username:    username,
+				Password:    password,
+				GracePeriod: gracePeriod,
+				DryRun:      dryRun,
+				Progress:    os.Stderr,
+				OnOrphan: func(oid string, info storage.ObjectInfo) {
+					fmt.Printf("%s %s %d %s\n", action, oid, info.Size, info.LastModified.Format(time.RFC3339))
+				},
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("scanned %d commits, %d referenced objects, %d stored objects\n", result.Commits, result.Referenced, result.Objects)
+			if dryRun {
+				fmt.Printf("%d orphaned objects (%d bytes) would be deleted, %d kept within the grace period\n", result.Orphaned, result.OrphanedBytes, result.InGracePeriod)
+			} else {
+				fmt.Printf("%d orphaned objects (%d bytes) deleted, %d kept within the grace period\n", result.Orphaned, result.OrphanedBytes, result.InGracePeriod)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Read storage settings from provided configuration file")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Repository path, e.g. owner/repo")
+	StartCmd.PersistentFlags().StringVar(&repoURL, "url", "", "Repository URL to clone, defaults to the repository on the upstream forge")
+	StartCmd.PersistentFlags().StringVar(&dir, "dir", "", "Local bare repository to reuse between runs, cloned into a temporary directory if empty")
+	StartCmd.PersistentFlags().StringVarP(&username, "username", "u", "", "Username for cloning the repository")
+	StartCmd.PersistentFlags().StringVarP(&password, "password", "p", "", "Password or token for cloning the repository")
+	StartCmd.PersistentFlags().DurationVar(&gracePeriod, "grace-period", 7*24*time.Hour, "Keep unreferenced objects modified within this period")
+	StartCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Only report orphaned objects without deleting them")
+	_ = StartCmd.MarkPersistentFlagRequired("repo")
+}
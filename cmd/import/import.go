@@ -0,0 +1,95 @@
+// Package importcmd 实现 import 子命令，import 是关键字因此不能作为包名
+package importcmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/archive"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configPath string
+	repoPath   string
+	inputPath  string
+	verbose    bool
+	StartCmd   = &cobra.Command{
+		Use:   "import",
+		Short: "Import LFS objects from an archive created by export",
+		Long: "Restore an archive created by the export command, plain or zstd-compressed, into the\n" +
+			"configured bucket. Every object is verified against its OID before it becomes visible;\n" +
+			"objects that already exist are skipped.",
+		Example: "lfs-s3 import -c ./config.yaml -i repo.tar.zst -r partner/repo",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := archive.ImportOptions{}
+			if repoPath != "" {
+				r, err := repo.Parse(repoPath)
+				if err != nil {
+					return errors.Wrapf(err, "parse repo %q", repoPath)
+				}
+				opts.Repo = &r
+			}
+			config, err := lfsS3.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			s, err := storage.NewS3Storage(config.S3)
+			if err != nil {
+				return err
+			}
+			layout, err := handler.NewLayout(config.Layout, config.S3, s)
+			if err != nil {
+				return err
+			}
+
+			var r io.Reader = os.Stdin
+			if inputPath != "" && inputPath != "-" {
+				f, err := os.Open(inputPath)
+				if err != nil {
+					return errors.Wrap(err, "open archive")
+				}
+				defer f.Close()
+				r = f
+			}
+			if verbose {
+				opts.OnObject = func(obj archive.Object, skipped bool) {
+					status := "imported"
+					if skipped {
+						status = "skipped"
+					}
+					fmt.Fprintf(os.Stderr, "%s %d %s\n", obj.OID, obj.Size, status)
+				}
+			}
+
+			opts.Layout = layout
+			manifest, result, err := archive.Import(cmd.Context(), s, r, opts)
+			if result != nil {
+				target := manifest.Repo
+				if opts.Repo != nil {
+					target = opts.Repo.String()
+				}
+				fmt.Fprintf(os.Stderr, "imported %d objects (%d bytes) into %s, %d skipped\n",
+					result.Objects, result.Bytes, target, result.Skipped)
+			}
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Read storage settings from provided configuration file")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Import into provided repository instead of the one recorded in the manifest")
+	StartCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "-", "Read the archive from provided file, - for stdin")
+	StartCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print every imported object to stderr")
+}
@@ -3,7 +3,15 @@ package cmd
 import (
 	"os"
 
+	"github.com/asjdf/lfs-s3/cmd/bench"
 	"github.com/asjdf/lfs-s3/cmd/config"
+	"github.com/asjdf/lfs-s3/cmd/export"
+	"github.com/asjdf/lfs-s3/cmd/fsck"
+	"github.com/asjdf/lfs-s3/cmd/gc"
+	importcmd "github.com/asjdf/lfs-s3/cmd/import"
+	"github.com/asjdf/lfs-s3/cmd/migrate"
+	"github.com/asjdf/lfs-s3/cmd/prereceive"
+	"github.com/asjdf/lfs-s3/cmd/relayout"
 	"github.com/asjdf/lfs-s3/cmd/server"
 	"github.com/spf13/cobra"
 )
@@ -13,7 +21,15 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.AddCommand(bench.StartCmd)
 	rootCmd.AddCommand(config.StartCmd)
+	rootCmd.AddCommand(export.StartCmd)
+	rootCmd.AddCommand(fsck.StartCmd)
+	rootCmd.AddCommand(gc.StartCmd)
+	rootCmd.AddCommand(importcmd.StartCmd)
+	rootCmd.AddCommand(migrate.StartCmd)
+	rootCmd.AddCommand(prereceive.StartCmd)
+	rootCmd.AddCommand(relayout.StartCmd)
 	rootCmd.AddCommand(server.StartCmd)
 }
 
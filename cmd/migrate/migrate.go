@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/migrate"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// passwordEnv 通过环境变量传入密码，避免出现在进程列表中
+const passwordEnv = "LFS_S3_SOURCE_PASSWORD"
+
+var (
+	configPath string
+	repoPath   string
+	endpoint   string
+	gitURL     string
+	dir        string
+	username   string
+	password   string
+	parallel   int
+	batchSize  int
+	StartCmd   = &cobra.Command{
+		Use:   "migrate",
+		Short: "Import LFS objects of a repository from another LFS server",
+		Long: "Collect LFS pointers from the repository history, request them from the source LFS server\n" +
+			"and stream them into the bucket. Objects already stored are skipped, so an interrupted\n" +
+			"migration can be resumed by running the command again. The password can also be provided\n" +
+			"with the " + passwordEnv + " environment variable.",
+		Example: "lfs-s3 migrate -c ./config.yaml -r owner/repo --endpoint https://git.example.com/owner/repo.git/info/lfs -u user",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := repo.Parse(repoPath)
+			if err != nil {
+				return errors.Wrapf(err, "parse repo %q", repoPath)
+			}
+			config, err := lfsS3.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			s, err := storage.NewS3Storage(config.S3)
+			if err != nil {
+				return err
+			}
+			layout, err := handler.NewLayout(config.Layout, config.S3, s)
+			if err != nil {
+				return err
+			}
+			if password == "" {
+				password = os.Getenv(passwordEnv)
+			}
+
+			start := time.Now()
+			lastReport := time.Time{}
+			result, err := migrate.Run(cmd.Context(), s, migrate.Options{
+				Repo:      r,
+				Layout:    layout,
+				Endpoint:  endpoint,
+				GitURL:    gitURL,
+				Dir:       dir,
+				Username:  username,
+				Password:  password,
+				Parallel:  parallel,
+				BatchSize: batchSize,
+				Progress:  os.Stderr,
+				OnProgress: func(result migrate.Result) {
+					if time.Since(lastReport) < time.Second && result.Done() < result.Objects {
+						return
+					}
+					lastReport = time.Now()
+					fmt.Fprintf(os.Stderr, "progress: %d/%d objects, %d skipped, %d migrated (%d bytes), %d failed\n",
+						result.Done(), result.Objects, result.Skipped, result.Migrated, result.MigratedBytes, result.Failed)
+				},
+				OnError: func(oid string, err error) {
+					fmt.Printf("failed %s: %s\n", oid, err)
+				},
+			})
+			if result != nil {
+				fmt.Printf("scanned %d commits, %d objects (%d bytes): %d already stored, %d migrated (%d bytes), %d failed in %s\n",
+					result.Commits, result.Objects, result.Bytes, result.Skipped, result.Migrated, result.MigratedBytes, result.Failed,
+					time.Since(start).Round(time.Second))
+			}
+			if err != nil {
+				return err
+			}
+			if result.Failed > 0 {
+				cmd.SilenceUsage = true
+				return errors.Errorf("%d objects failed to migrate, run the command again to retry", result.Failed)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Read storage settings from provided configuration file")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Target repository path, e.g. owner/repo")
+	StartCmd.PersistentFlags().StringVar(&endpoint, "endpoint", "", "Source LFS endpoint, e.g. https://git.example.com/owner/repo.git/info/lfs")
+	StartCmd.PersistentFlags().StringVar(&gitURL, "git-url", "", "Repository URL to collect pointers from, defaults to the endpoint without /info/lfs")
+	StartCmd.PersistentFlags().StringVar(&dir, "dir", "", "Local bare repository to reuse between runs, cloned into a temporary directory if empty")
+	StartCmd.PersistentFlags().StringVarP(&username, "username", "u", "", "Username for the source LFS server and repository")
+	StartCmd.PersistentFlags().StringVarP(&password, "password", "p", "", "Password or token for the source LFS server and repository")
+	StartCmd.PersistentFlags().IntVar(&parallel, "parallel", 4, "Number of objects to transfer concurrently")
+	StartCmd.PersistentFlags().IntVar(&batchSize, "batch-size", 100, "Number of objects per batch request to the source")
+	_ = StartCmd.MarkPersistentFlagRequired("repo")
+	_ = StartCmd.MarkPersistentFlagRequired("endpoint")
+}
@@ -0,0 +1,179 @@
+package prereceive
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/prereceive"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// passwordEnv 通过环境变量传入密码，避免出现在钩子脚本与进程列表中
+const passwordEnv = "LFS_S3_HOOK_PASSWORD"
+
+var (
+	url      string
+	repoPath string
+	username string
+	password string
+	certFile string
+	keyFile  string
+	caFile   string
+	insecure bool
+	StartCmd = &cobra.Command{
+		Use:   "pre-receive",
+		Short: "Reject pushes that reference LFS objects missing from storage",
+		Long: "Run as the pre-receive hook of a repository on the forge. For every updated reference read\n" +
+			"from stdin (<old> <new> <ref>), the objects introduced by the push are packed with git and sent\n" +
+			"to the pre-receive endpoint of a running server, which scans the new commits for LFS pointers\n" +
+			"and checks that every object exists in storage. The command exits with a non-zero status when\n" +
+			"any object is missing. The password can also be provided with the " + passwordEnv + "\n" +
+			"environment variable.",
+		Example: "lfs-s3 pre-receive --url https://lfs.example.com/lfs -r owner/repo -u <username>",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if url == "" {
+				return errors.New("--url is required")
+			}
+			r, err := repo.Parse(repoPath)
+			if err != nil {
+				return errors.Wrapf(err, "parse repo %q", repoPath)
+			}
+			if password == "" {
+				password = os.Getenv(passwordEnv)
+			}
+			httpClient, err := newClient()
+			if err != nil {
+				return err
+			}
+			client := &prereceive.Client{
+				URL:      strings.TrimSuffix(url, "/"),
+				Username: username,
+				Password: password,
+				Client:   httpClient,
+			}
+
+			cmd.SilenceUsage = true
+			missing := 0
+			scanner := bufio.NewScanner(cmd.InOrStdin())
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) != 3 {
+					return errors.Errorf("invalid input line %q, expected <old> <new> <ref>", scanner.Text())
+				}
+				oldRev, newRev, ref := fields[0], fields[1], fields[2]
+				if plumbing.NewHash(newRev).IsZero() {
+					continue
+				}
+
+				objects, err := check(cmd.Context(), client, r, oldRev, newRev)
+				if err != nil {
+					return errors.Wrapf(err, "check %s", ref)
+				}
+				for _, obj := range objects {
+					fmt.Fprintf(os.Stderr, "%s: %s (%s, %d bytes) in commit %.12s is missing from LFS storage\n",
+						ref, obj.Path, obj.OID, obj.Size, obj.Commit)
+				}
+				missing += len(objects)
+			}
+			if err := scanner.Err(); err != nil {
+				return errors.Wrap(err, "read stdin")
+			}
+			if missing > 0 {
+				return errors.Errorf("%d LFS objects are missing, push them with `git lfs push --all` first", missing)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVar(&url, "url", "", "LFS endpoint of the server including the base path, e.g. https://lfs.example.com/lfs")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Repository the hook belongs to, e.g. owner/repo")
+	StartCmd.PersistentFlags().StringVarP(&username, "username", "u", "", "Username for the forge")
+	StartCmd.PersistentFlags().StringVarP(&password, "password", "p", "", "Password or token for the forge")
+	StartCmd.PersistentFlags().StringVar(&certFile, "cert", "", "Client certificate for mutual TLS")
+	StartCmd.PersistentFlags().StringVar(&keyFile, "key", "", "Client key for mutual TLS")
+	StartCmd.PersistentFlags().StringVar(&caFile, "ca", "", "CA certificate to verify the server with")
+	StartCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "Skip verifying the server certificate")
+	_ = StartCmd.MarkPersistentFlagRequired("repo")
+}
+
+// check 将 newRev 引入且尚未被任何引用包含的对象打包后发送给服务，
+// 钩子运行时引用尚未更新，隔离区中的新对象对 git 命令可见
+func check(ctx context.Context, client *prereceive.Client, r repo.Repo, oldRev, newRev string) ([]prereceive.Missing, error) {
+	// 返回时终止仍在运行的 git 进程
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	revList := exec.CommandContext(ctx, "git", "rev-list", "--objects", newRev, "--not", "--all")
+	revList.Stderr = os.Stderr
+	objects, err := revList.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	packObjects := exec.CommandContext(ctx, "git", "pack-objects", "--stdout", "-q")
+	packObjects.Stdin = objects
+	packObjects.Stderr = os.Stderr
+	pack, err := packObjects.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := revList.Start(); err != nil {
+		return nil, errors.Wrap(err, "start git rev-list")
+	}
+	if err := packObjects.Start(); err != nil {
+		cancel()
+		_ = revList.Wait()
+		return nil, errors.Wrap(err, "start git pack-objects")
+	}
+
+	missing, err := client.Check(ctx, r, oldRev, newRev, pack)
+	// 读完剩余输出后才能等待进程退出
+	_, _ = io.Copy(io.Discard, pack)
+	packErr := packObjects.Wait()
+	revErr := revList.Wait()
+	switch {
+	case err != nil:
+		return nil, err
+	case revErr != nil:
+		return nil, errors.Wrap(revErr, "git rev-list")
+	case packErr != nil:
+		return nil, errors.Wrap(packErr, "git pack-objects")
+	}
+	return missing, nil
+}
+
+func newClient() (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificate found in ca")
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
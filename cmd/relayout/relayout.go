@@ -0,0 +1,87 @@
+package relayout
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/relayout"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configPath   string
+	repoPath     string
+	layoutName   string
+	targetBucket string
+	parallel     int
+	checkpoint   string
+	StartCmd     = &cobra.Command{
+		Use:   "relayout",
+		Short: "Copy stored objects into a new key layout or bucket",
+		Long: "Server-side copy every object stored under the repository layout (<owner>/<repo>/<oid>)\n" +
+			"into the target layout and bucket, verifying size and ETag after each copy. Source objects\n" +
+			"are kept so that the server can read both layouts during the migration. Progress is saved\n" +
+			"to the checkpoint file and an interrupted run continues where it stopped.",
+		Example: "lfs-s3 relayout -c ./config.yaml --layout content --target-bucket lfs-new --parallel 16",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := relayout.Options{Parallel: parallel, Checkpoint: checkpoint}
+			if repoPath != "" {
+				r, err := repo.Parse(repoPath)
+				if err != nil {
+					return errors.Wrapf(err, "parse repo %q", repoPath)
+				}
+				opts.Repo = &r
+			}
+			layout, err := storage.ParseLayout(layoutName)
+			if err != nil {
+				return err
+			}
+			opts.Layout = layout
+
+			config, err := lfsS3.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			s, err := storage.NewS3Storage(config.S3)
+			if err != nil {
+				return err
+			}
+			if targetBucket != "" && targetBucket != config.S3.BucketName {
+				targetConfig := config.S3
+				targetConfig.BucketName = targetBucket
+				if opts.Target, err = storage.NewS3Storage(targetConfig); err != nil {
+					return err
+				}
+			}
+			opts.OnError = func(key string, err error) {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", key, err)
+			}
+
+			result, err := relayout.Run(cmd.Context(), s, opts)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			fmt.Printf("%d objects, %d copied (%d bytes), %d already present, %d failed\n",
+				result.Objects, result.Copied, result.Bytes, result.Skipped, result.Failed)
+			if result.Failed > 0 {
+				cmd.SilenceUsage = true
+				return errors.Errorf("%d objects failed, run again to retry", result.Failed)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	StartCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Read storage settings from provided configuration file")
+	StartCmd.PersistentFlags().StringVarP(&repoPath, "repo", "r", "", "Only copy objects of the provided repository, e.g. owner/repo; copies the whole bucket if empty")
+	StartCmd.PersistentFlags().StringVar(&layoutName, "layout", string(storage.LayoutContent), "Target key layout, repo or content")
+	StartCmd.PersistentFlags().StringVar(&targetBucket, "target-bucket", "", "Copy into provided bucket on the same endpoint; uses the configured bucket if empty")
+	StartCmd.PersistentFlags().IntVar(&parallel, "parallel", 4, "Number of objects to copy concurrently")
+	StartCmd.PersistentFlags().StringVar(&checkpoint, "checkpoint", "relayout.checkpoint.json", "Save progress to provided file and resume from it; empty to disable")
+}
@@ -1,12 +1,14 @@
 package modList
 
 import (
+	"github.com/asjdf/lfs-s3/mod/grpcx"
 	"github.com/asjdf/lfs-s3/mod/jinx"
 	"github.com/asjdf/lfs-s3/mod/lfsS3"
 	"github.com/juanjiTech/jframe/core/kernel"
 )
 
 var ModList = []kernel.Module{
+	&grpcx.Mod{},
 	&jinx.Mod{},
 	&lfsS3.Mod{},
 }
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/cmd/config"
+	"github.com/asjdf/lfs-s3/pkg/envconf"
+	"github.com/juanjiTech/jframe/conf"
+	"github.com/juanjiTech/jframe/core/kernel"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// reloadable 由支持热加载配置的模块实现，config 与 Config() 的类型相同；
+// 失败时模块必须继续使用原来的配置，成功后 Config() 返回实际生效的配置
+type reloadable interface {
+	Reload(config any) error
+}
+
+// reload 重新读取配置文件与环境变量并校验，校验失败时保留当前配置；
+// 校验通过后交给支持热加载的模块，其余模块的变更需要重启才能生效
+func reload(mods []kernel.Module) {
+	log := logx.NameSpace("reload")
+	log.Infow("reloading config", "file", viper.ConfigFileUsed())
+
+	v := viper.New()
+	v.SetConfigFile(viper.ConfigFileUsed())
+	if err := v.ReadInConfig(); err != nil {
+		log.Errorw("failed to read config, keeping the current one", "error", err)
+		return
+	}
+	if err := envconf.ApplyModules(v, mods...); err != nil {
+		log.Errorw("failed to apply config from environment, keeping the current one", "error", err)
+		return
+	}
+
+	var problems []string
+	global := &conf.GlobalConfig{}
+	if err := v.Unmarshal(global); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, err := range config.ValidateGlobal(global) {
+		problems = append(problems, err.Error())
+	}
+	configs := make([]any, len(mods))
+	for i, mod := range mods {
+		if mod.Config() == nil {
+			continue
+		}
+		c := reflect.New(reflect.TypeOf(mod.Config()).Elem()).Interface()
+		if err := v.UnmarshalKey(mod.Name(), c); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", mod.Name(), err))
+			continue
+		}
+		if validator, ok := c.(config.Validator); ok {
+			for _, err := range validator.Validate() {
+				problems = append(problems, fmt.Sprintf("%s.%v", mod.Name(), err))
+			}
+		}
+		configs[i] = c
+	}
+	if len(problems) > 0 {
+		log.Errorw("invalid config, keeping the current one", "problems", problems)
+		return
+	}
+
+	for i, mod := range mods {
+		if configs[i] == nil {
+			continue
+		}
+		before := flatten(mod.Config())
+		r, ok := mod.(reloadable)
+		if !ok {
+			for _, c := range diff(before, flatten(configs[i])) {
+				log.Warnw("config change requires restart", "key", mod.Name()+"."+c.key)
+			}
+			continue
+		}
+		if err := r.Reload(configs[i]); err != nil {
+			log.Errorw("failed to reload module, keeping its current config", "module", mod.Name(), "error", err)
+			continue
+		}
+		for _, c := range diff(before, flatten(mod.Config())) {
+			log.Infow("config changed", "key", mod.Name()+"."+c.key, "old", c.old, "new", c.new)
+		}
+	}
+	log.Info("config reloaded")
+}
+
+type change struct {
+	key      string
+	old, new string
+}
+
+// diff 返回两份展开后的配置中值不同的配置项，敏感配置项的值会被隐藏
+func diff(before, after map[string]string) []change {
+	var changes []change
+	for key, old := range before {
+		if n := after[key]; n != old {
+			changes = append(changes, change{key: key, old: old, new: n})
+		}
+	}
+	for key, n := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, change{key: key, new: n})
+		}
+	}
+	for i, c := range changes {
+		if config.IsSecret(c.key[strings.LastIndex(c.key, ".")+1:]) {
+			changes[i].old, changes[i].new = config.Redacted, config.Redacted
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+	return changes
+}
+
+// flatten 将配置展开为以点分隔的配置键到值的映射，列表作为一个整体的值
+func flatten(c any) map[string]string {
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil
+	}
+	values := map[string]string{}
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i].Value
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				walk(key, n.Content[i+1])
+			}
+			return
+		}
+		if n.Kind == yaml.ScalarNode {
+			values[prefix] = n.Value
+			return
+		}
+		var value any
+		_ = n.Decode(&value)
+		data, _ := json.Marshal(value)
+		values[prefix] = string(data)
+	}
+	walk("", &node)
+	return values
+}
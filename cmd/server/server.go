@@ -8,12 +8,14 @@ import (
 	"syscall"
 
 	"github.com/asjdf/lfs-s3/cmd/server/modList"
+	"github.com/asjdf/lfs-s3/pkg/envconf"
 	"github.com/juanjiTech/jframe/conf"
 	"github.com/juanjiTech/jframe/core/kernel"
 	"github.com/juanjiTech/jframe/core/logx"
 	"github.com/juanjiTech/jframe/pkg/ip"
 	"github.com/soheilhy/cmux"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -29,6 +31,12 @@ var (
 			conf.LoadConfig(configPath)
 			logx.Init(zapcore.DebugLevel)
 
+			// 环境变量覆盖配置文件中的模块配置
+			if err := envconf.ApplyModules(viper.GetViper(), modList.ModList...); err != nil {
+				zap.S().Errorw("failed to apply config from environment", "error", err)
+				return err
+			}
+
 			conn, err := net.Listen("tcp", fmt.Sprintf(":%s", conf.Get().Port))
 			if err != nil {
 				zap.S().Errorw("failed to listen", "error", err)
@@ -59,9 +67,15 @@ var (
 				fmt.Printf("-  Network: http://%s:%s\n", host, conf.Get().Port)
 			}
 
+			// SIGHUP 重新加载配置，SIGINT 与 SIGTERM 停止服务
 			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-			<-quit
+			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+			for sig := range quit {
+				if sig != syscall.SIGHUP {
+					break
+				}
+				reload(modList.ModList)
+			}
 
 			return k.Stop()
 		},
@@ -0,0 +1,164 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/tlsx"
+	"github.com/juanjiTech/jframe/core/kernel"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/soheilhy/cmux"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ kernel.Module = (*Mod)(nil)
+
+type Config struct {
+	Enable bool `yaml:"enable"`
+}
+
+// ServiceAuthFuncOverride is implemented by services that authenticate their own calls.
+// Services that don't implement it are rejected, so nothing is exposed unauthenticated by accident.
+type ServiceAuthFuncOverride interface {
+	AuthFuncOverride(ctx context.Context, fullMethodName string) (context.Context, error)
+}
+
+type Mod struct {
+	kernel.UnimplementedModule // 请为所有Module引入UnimplementedModule
+
+	config   Config
+	listener net.Listener
+	srv      *grpc.Server
+	log      *zap.SugaredLogger
+}
+
+func (m *Mod) Name() string {
+	return "grpcx"
+}
+
+func (m *Mod) Config() any {
+	return &m.config
+}
+
+func (m *Mod) PreInit(hub *kernel.Hub) error {
+	if !m.config.Enable {
+		return nil
+	}
+	m.log = logx.NameSpace("grpc")
+	m.srv = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(m.unaryInterceptor),
+		grpc.ChainStreamInterceptor(m.streamInterceptor),
+	)
+	hub.Map(&m.srv)
+	return nil
+}
+
+func (m *Mod) PostInit(hub *kernel.Hub) error {
+	if !m.config.Enable {
+		return nil
+	}
+	// jinx serves gRPC over its TLS connections, cleartext h2c would expose
+	// credentials such as the admin token
+	var reloader *tlsx.Reloader
+	if hub.Load(&reloader) == nil {
+		m.log.Info("tls is enabled, serving grpc over tls through jinx")
+		return nil
+	}
+	var tcpMux cmux.CMux
+	if hub.Load(&tcpMux) != nil {
+		return errors.New("can't load tcpMux from kernel")
+	}
+	// match before jinx so that gRPC requests are not taken by the HTTP/2 matcher
+	m.listener = tcpMux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	return nil
+}
+
+func (m *Mod) Start(hub *kernel.Hub) error {
+	if m.srv == nil || m.listener == nil {
+		return nil
+	}
+	if err := m.srv.Serve(m.listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		hub.Log.Infow("failed to serve grpc", "error", err)
+	}
+	return nil
+}
+
+func (m *Mod) Stop(wg *sync.WaitGroup, ctx context.Context) error {
+	defer wg.Done()
+	if m.srv == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		m.srv.Stop()
+	case <-ctx.Done():
+		m.srv.Stop()
+	}
+	return nil
+}
+
+func authorize(ctx context.Context, srv any, fullMethod string) (context.Context, error) {
+	override, ok := srv.(ServiceAuthFuncOverride)
+	if !ok {
+		return ctx, status.Error(codes.Unauthenticated, "service does not support authentication")
+	}
+	return override.AuthFuncOverride(ctx, fullMethod)
+}
+
+func (m *Mod) recover(method string, err *error) {
+	if r := recover(); r != nil {
+		m.log.Errorw("grpc handler panic", "method", method, "panic", r, "stack", string(debug.Stack()))
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+func (m *Mod) logCall(method string, start time.Time, err error) {
+	m.log.Infow("grpc", "method", method, "code", status.Code(err).String(), "latency", time.Since(start).String())
+}
+
+func (m *Mod) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	start := time.Now()
+	defer func() { m.logCall(info.FullMethod, start, err) }()
+	defer m.recover(info.FullMethod, &err)
+
+	ctx, err = authorize(ctx, info.Server, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (m *Mod) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	defer func() { m.logCall(info.FullMethod, start, err) }()
+	defer m.recover(info.FullMethod, &err)
+
+	ctx, err := authorize(ss.Context(), srv, info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
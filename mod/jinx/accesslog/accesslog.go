@@ -0,0 +1,90 @@
+package accesslog
+
+import (
+	"math/rand/v2"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/juanjiTech/jin"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Enable bool `yaml:"enable"`
+	// SampleRate 成功请求的采样比例（0~1），为 0 时记录全部请求；错误请求始终记录
+	SampleRate float64 `yaml:"sampleRate"`
+}
+
+// Entry holds LFS specific fields filled by downstream handlers.
+// Never put credentials into it.
+type Entry struct {
+	User      string
+	Owner     string
+	Repo      string
+	Operation string
+	Objects   int
+	Bytes     int64
+}
+
+var entryType = reflect.TypeOf((*Entry)(nil))
+
+// FromContext returns the Entry of current request, nil if access log is disabled.
+func FromContext(c *jin.Context) *Entry {
+	if v := c.Value(entryType); v.IsValid() {
+		return v.Interface().(*Entry)
+	}
+	return nil
+}
+
+func New(config Config) jin.HandlerFunc {
+	logger := logx.NameSpace("accesslog").Desugar().WithOptions(zap.WithCaller(false))
+
+	return func(c *jin.Context) {
+		start := time.Now()
+		entry := &Entry{}
+		c.Map(entry)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < 400 && config.SampleRate > 0 && config.SampleRate < 1 && rand.Float64() >= config.SampleRate {
+			return
+		}
+
+		remoteIP, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			remoteIP = c.Request.RemoteAddr
+		}
+		fields := []zap.Field{
+			zap.String("request_id", requestid.FromContext(c.Request.Context())),
+			zap.String("remote_ip", remoteIP),
+			zap.String("method", c.Request.Method),
+			// 只记录路径，查询参数中可能携带凭据
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("response_size", c.Writer.Size()),
+		}
+		if forwardedFor := c.Request.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			fields = append(fields, zap.String("forwarded_for", forwardedFor))
+		}
+		if entry.User != "" {
+			fields = append(fields, zap.String("user", entry.User))
+		}
+		if entry.Owner != "" {
+			fields = append(fields, zap.String("owner", entry.Owner), zap.String("repo", entry.Repo))
+		}
+		if entry.Operation != "" {
+			fields = append(fields,
+				zap.String("operation", entry.Operation),
+				zap.Int("objects", entry.Objects),
+				zap.Int64("bytes", entry.Bytes),
+			)
+		}
+
+		logger.Info("access", fields...)
+	}
+}
@@ -0,0 +1,68 @@
+package jinx
+
+import (
+	"path"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/juanjiTech/jin"
+	"github.com/juanjiTech/jin/middleware/cors"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+type CORSConfig struct {
+	// Enable 默认关闭，关闭时不返回任何 CORS 响应头，浏览器将拒绝跨域请求
+	Enable bool `yaml:"enable"`
+	// AllowOrigins 允许的来源，支持通配符，例如 https://*.example.com；单独的 * 表示允许所有来源
+	AllowOrigins []string `yaml:"allowOrigins"`
+	// AllowMethods 为空时允许 GET、POST、OPTIONS
+	AllowMethods []string `yaml:"allowMethods"`
+	// AllowHeaders 额外允许的请求头，Authorization、Content-Type 等已默认允许
+	AllowHeaders  []string `yaml:"allowHeaders"`
+	ExposeHeaders []string `yaml:"exposeHeaders"`
+	// MaxAge 预检请求结果的缓存时间（秒），为 0 时为 12 小时
+	MaxAge           int  `yaml:"maxAge"`
+	AllowCredentials bool `yaml:"allowCredentials"`
+}
+
+func newCORS(config CORSConfig) (jin.HandlerFunc, error) {
+	corsConf := cors.DefaultConfig()
+	corsConf.AllowMethods = []string{"GET", "POST", "OPTIONS"}
+	if len(config.AllowMethods) > 0 {
+		corsConf.AllowMethods = config.AllowMethods
+	}
+	corsConf.AddAllowHeaders("Accept", "Authorization", requestid.Header)
+	corsConf.AddAllowHeaders(config.AllowHeaders...)
+	corsConf.AddExposeHeaders(requestid.Header)
+	corsConf.AddExposeHeaders(config.ExposeHeaders...)
+	if config.MaxAge > 0 {
+		corsConf.MaxAge = time.Duration(config.MaxAge) * time.Second
+	}
+	corsConf.AllowCredentials = config.AllowCredentials
+
+	if len(config.AllowOrigins) == 0 {
+		return nil, errors.New("cors is enabled but allowOrigins is empty")
+	}
+	if lo.Contains(config.AllowOrigins, "*") {
+		// 浏览器不接受携带凭据的通配来源，且这样会把预签名地址暴露给任意网站
+		if config.AllowCredentials {
+			return nil, errors.New("cors allowOrigins * can't be used together with allowCredentials")
+		}
+		corsConf.AllowAllOrigins = true
+		return cors.New(corsConf), nil
+	}
+
+	for _, pattern := range config.AllowOrigins {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid cors origin %q", pattern)
+		}
+	}
+	corsConf.AllowOriginFunc = func(origin string) bool {
+		return lo.ContainsBy(config.AllowOrigins, func(pattern string) bool {
+			ok, _ := path.Match(pattern, origin)
+			return ok
+		})
+	}
+	return cors.New(corsConf), nil
+}
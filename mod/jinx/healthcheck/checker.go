@@ -1,15 +1,44 @@
 package healthcheck
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Checker interface {
-	Pass() bool
+	// Check returns nil if the checked dependency is healthy, otherwise an
+	// error describing why it is not. Check must respect ctx cancellation.
+	Check(ctx context.Context) error
 	Name() string
 }
 
+// TimeoutChecker can be implemented by a Checker to override DefaultTimeout.
+type TimeoutChecker interface {
+	Timeout() time.Duration
+}
+
+// IntervalChecker can be implemented by a Checker to override DefaultMinInterval.
+type IntervalChecker interface {
+	MinInterval() time.Duration
+}
+
+// OptionalChecker can be implemented by a Checker whose failure degrades the
+// service instead of making it unready, e.g. an external dependency.
+type OptionalChecker interface {
+	Optional() bool
+}
+
+var (
+	// DefaultTimeout bounds a single run of a checker.
+	DefaultTimeout = 5 * time.Second
+	// DefaultMinInterval is how long a result is reused before the checker runs again.
+	DefaultMinInterval = time.Second
+)
+
 type StatusCode int
 
 const (
@@ -18,6 +47,111 @@ const (
 	StatusError
 )
 
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "ok"
+	case StatusExcluded:
+		return "excluded"
+	default:
+		return "error"
+	}
+}
+
+func (c StatusCode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+type Result struct {
+	Status    StatusCode
+	Latency   time.Duration
+	Message   string
+	CheckedAt time.Time
+}
+
+// cachedChecker serializes runs of a checker and reuses its last result
+// within the minimum re-check interval.
+type cachedChecker struct {
+	Checker
+
+	// runMu serializes runs, mu only guards the results so readers are
+	// never blocked by a slow check
+	runMu   sync.Mutex
+	mu      sync.Mutex
+	last    *Result
+	history []Result
+	state   State
+}
+
+func newCachedChecker(checker Checker) *cachedChecker {
+	return &cachedChecker{Checker: checker}
+}
+
+func (c *cachedChecker) timeout() time.Duration {
+	if t, ok := c.Checker.(TimeoutChecker); ok && t.Timeout() > 0 {
+		return t.Timeout()
+	}
+	return DefaultTimeout
+}
+
+func (c *cachedChecker) minInterval() time.Duration {
+	if t, ok := c.Checker.(IntervalChecker); ok && t.MinInterval() > 0 {
+		return t.MinInterval()
+	}
+	return DefaultMinInterval
+}
+
+func (c *cachedChecker) optional() bool {
+	o, ok := c.Checker.(OptionalChecker)
+	return ok && o.Optional()
+}
+
+func (c *cachedChecker) run(ctx context.Context) Result {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	if r, ok := c.cached(); ok {
+		return r
+	}
+	r := c.check(ctx)
+	c.mu.Lock()
+	c.last = &r
+	c.mu.Unlock()
+	return r
+}
+
+// cached returns the last result if it is within the minimum re-check
+// interval.
+func (c *cachedChecker) cached() (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && time.Since(c.last.CheckedAt) < c.minInterval() {
+		return *c.last, true
+	}
+	return Result{}, false
+}
+
+// check runs the checker unconditionally without touching the cached
+// state, c.runMu must be held.
+func (c *cachedChecker) check(ctx context.Context) Result {
+	// the result is shared by concurrent callers, so a cancelled caller
+	// must not turn it into a failure
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout())
+	defer cancel()
+
+	start := time.Now()
+	err := c.Check(ctx)
+	r := Result{
+		Status:    StatusOK,
+		Latency:   time.Since(start),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		r.Status = StatusError
+		r.Message = err.Error()
+	}
+	return r
+}
+
 var stringBuilderPool = sync.Pool{
 	New: func() any {
 		return &strings.Builder{}
@@ -26,53 +160,99 @@ var stringBuilderPool = sync.Pool{
 
 type Status struct {
 	sync.Mutex
-	m map[string]StatusCode
+	m      map[string]Result
+	states map[string]State
 }
 
 func NewStatus(n int) *Status {
 	return &Status{
-		m: make(map[string]StatusCode, n),
+		m:      make(map[string]Result, n),
+		states: make(map[string]State, n),
 	}
 }
-func (s *Status) Get(k string) (StatusCode, bool) {
+func (s *Status) Get(k string) (Result, bool) {
 	s.Lock()
 	defer s.Unlock()
 	v, ok := s.m[k]
 	return v, ok
 }
 
-func (s *Status) Set(k string, v StatusCode) {
+func (s *Status) Set(k string, v Result) {
 	s.Lock()
 	defer s.Unlock()
 	s.m[k] = v
 }
 
-func (s *Status) Each(f func(string, StatusCode)) {
+// SetState records the background probing state of a check, which then
+// decides whether the check passes instead of its latest result.
+func (s *Status) SetState(k string, v State) {
 	s.Lock()
 	defer s.Unlock()
-	for k, v := range s.m {
-		f(k, v)
+	s.states[k] = v
+}
+
+// State returns the worst probing state, ok is false if no state was recorded.
+func (s *Status) State() (state State, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+	for _, v := range s.states {
+		state, ok = max(state, v), true
 	}
+	return state, ok
 }
 
-func (s *Status) String(verbose bool) string {
+// Each visits results ordered by checker name.
+func (s *Status) Each(f func(string, Result)) {
+	s.Lock()
+	defer s.Unlock()
+	names := make([]string, 0, len(s.m))
+	for k := range s.m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		f(k, s.m[k])
+	}
+}
+
+func (s *Status) Pass() bool {
 	allPass := true
+	s.Each(func(name string, r Result) {
+		if !s.passed(name, r) {
+			allPass = false
+		}
+	})
+	return allPass
+}
+
+// passed must be called with s locked.
+func (s *Status) passed(name string, r Result) bool {
+	if state, ok := s.states[name]; ok {
+		return state != StateUnhealthy
+	}
+	return r.Status != StatusError
+}
+
+func (s *Status) String(verbose bool) string {
+	allPass := s.Pass()
 	if verbose {
 		b := stringBuilderPool.Get().(*strings.Builder)
 		defer stringBuilderPool.Put(b)
 		defer b.Reset()
-		s.Each(func(name string, status StatusCode) {
-			switch status {
+		s.Each(func(name string, r Result) {
+			switch r.Status {
 			case StatusOK:
 				b.WriteString("[+] " + name + " ok\n")
 			case StatusError:
-				b.WriteString("[-] " + name + " fail\n")
-				allPass = false
+				b.WriteString("[-] " + name + " fail: " + r.Message + "\n")
 			case StatusExcluded:
 				b.WriteString("[+] " + name + " excluded: ok\n")
 			}
 		})
 
+		if state, ok := s.State(); ok {
+			b.WriteString("state: " + state.String() + "\n")
+		}
 		if allPass {
 			b.WriteString("healthz check passed")
 		} else {
@@ -81,19 +261,50 @@ func (s *Status) String(verbose bool) string {
 		return b.String()
 	}
 
-	s.Each(func(name string, status StatusCode) {
-		switch status {
-		case StatusOK:
-			allPass = false
-		case StatusError:
-			allPass = false
-		case StatusExcluded:
-			allPass = false
-		}
-	})
-
 	if allPass {
 		return "OK"
 	}
 	return "Fail"
 }
+
+type jsonCheck struct {
+	Name      string     `json:"name"`
+	Status    StatusCode `json:"status"`
+	State     *State     `json:"state,omitempty"`
+	LatencyMS float64    `json:"latency_ms"`
+	Message   string     `json:"message,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+type jsonStatus struct {
+	Status StatusCode  `json:"status"`
+	State  *State      `json:"state,omitempty"`
+	Checks []jsonCheck `json:"checks"`
+}
+
+func (s *Status) JSON() []byte {
+	out := jsonStatus{Status: StatusOK, Checks: []jsonCheck{}}
+	if !s.Pass() {
+		out.Status = StatusError
+	}
+	if state, ok := s.State(); ok {
+		out.State = &state
+	}
+	s.Each(func(name string, r Result) {
+		check := jsonCheck{
+			Name:      name,
+			Status:    r.Status,
+			LatencyMS: float64(r.Latency.Microseconds()) / 1000,
+			Message:   r.Message,
+		}
+		if !r.CheckedAt.IsZero() {
+			check.CheckedAt = &r.CheckedAt
+		}
+		if state, ok := s.states[name]; ok {
+			check.State = &state
+		}
+		out.Checks = append(out.Checks, check)
+	})
+	b, _ := json.Marshal(out)
+	return b
+}
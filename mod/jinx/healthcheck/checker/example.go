@@ -1,6 +1,10 @@
 package checker
 
-import "github.com/juanjiTech/jframe/mod/jinx/healthcheck"
+import (
+	"context"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/healthcheck"
+)
 
 var _ healthcheck.Checker = (*example)(nil)
 
@@ -11,8 +15,8 @@ func NewExample() healthcheck.Checker {
 type example struct {
 }
 
-func (e *example) Pass() bool {
-	return true
+func (e *example) Check(ctx context.Context) error {
+	return nil
 }
 
 func (e *example) Name() string {
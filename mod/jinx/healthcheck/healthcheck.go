@@ -6,15 +6,13 @@ import (
 	"sync"
 
 	"github.com/juanjiTech/jin"
-	"github.com/oklog/ulid/v2"
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
 	"golang.org/x/sync/errgroup"
-	"golang.org/x/sync/singleflight"
 )
 
 var (
-	defaultHealthChecker   = map[string]Checker{}
+	defaultHealthChecker   = map[string]*cachedChecker{}
 	defaultHealthCheckerMu sync.Mutex
 )
 
@@ -26,7 +24,7 @@ func RegisterHealthChecker(checkers ...Checker) error {
 			if _, ok := defaultHealthChecker[checker.Name()]; ok {
 				return ErrConflictCheckerName
 			}
-			defaultHealthChecker[checker.Name()] = checker
+			defaultHealthChecker[checker.Name()] = newCachedChecker(checker)
 			return nil
 		}()
 		if err != nil {
@@ -41,59 +39,89 @@ var (
 	ErrCheckFailed         = errors.New("health check failed")
 )
 
-var sg singleflight.Group
-
+// Register mounts /livez, which only tells the process is serving, and
+// /readyz, which runs every checker added by RegisterHealthChecker.
+// /healthz is kept as an alias of /readyz.
 func Register(e *jin.Engine) {
-	e.GET("/healthz", NewHandler(lo.MapToSlice(defaultHealthChecker, func(name string, checker Checker) Checker {
-		return checker
-	})...))
+	e.GET("/livez", NewHandler())
+	readyz := newHandler(registeredCheckers)
+	e.GET("/readyz", readyz)
+	e.GET("/healthz", readyz)
+}
+
+// registeredCheckers is evaluated per request, so checkers registered by
+// modules loaded after jinx are picked up as well.
+func registeredCheckers() []*cachedChecker {
+	defaultHealthCheckerMu.Lock()
+	defer defaultHealthCheckerMu.Unlock()
+	return lo.Values(defaultHealthChecker)
 }
 
 func NewHandler(checkers ...Checker) jin.HandlerFunc {
-	handlerID := ulid.Make().String()
+	cached := lo.Map(checkers, func(checker Checker, _ int) *cachedChecker {
+		return newCachedChecker(checker)
+	})
+	return newHandler(func() []*cachedChecker {
+		return cached
+	})
+}
 
+// newHandler serves the check results as plain text, or as JSON with
+// ?format=json. ?verbose lists every check in the plain text output and
+// ?exclude=a,b skips the named checks. While background probing is running
+// the latest probed results are served and only unhealthy checks fail.
+func newHandler(getCheckers func() []*cachedChecker) jin.HandlerFunc {
 	return func(c *jin.Context) {
-		verbose := c.Request.URL.Query().Has("verbose")
-		excludes := strings.Split(c.Request.URL.Query().Get("exclude"), ",")
-
-		body, err, _ := sg.Do(handlerID, func() (interface{}, error) {
-			status := NewStatus(len(checkers))
-			var eg errgroup.Group
+		query := c.Request.URL.Query()
+		verbose := query.Has("verbose")
+		excludes := strings.Split(query.Get("exclude"), ",")
 
-			for _, checker := range checkers {
-				eg.Go(func() error {
-					name := checker.Name()
-					if len(excludes) > 0 {
-						for _, excludedName := range excludes {
-							if excludedName == name {
-								status.Set(name, StatusExcluded)
-								return nil
-							}
+		checkers := getCheckers()
+		status := NewStatus(len(checkers))
+		var eg errgroup.Group
+		for _, checker := range checkers {
+			name := checker.Name()
+			if lo.Contains(excludes, name) {
+				status.Set(name, Result{Status: StatusExcluded})
+				continue
+			}
+			eg.Go(func() error {
+				if probing() {
+					if r, state, ok := checker.probed(); ok {
+						status.Set(name, r)
+						status.SetState(name, state)
+						if state == StateUnhealthy {
+							return ErrCheckFailed
 						}
+						return nil
 					}
+				}
 
-					if _, ok := status.Get(name); ok {
-						return ErrConflictCheckerName
+				r := checker.run(c.Request.Context())
+				status.Set(name, r)
+				if r.Status == StatusError {
+					if checker.optional() {
+						status.SetState(name, StateDegraded)
+						return nil
 					}
+					return ErrCheckFailed
+				}
+				return nil
+			})
+		}
 
-					if checker.Pass() {
-						status.Set(name, StatusOK)
-					} else {
-						status.Set(name, StatusError)
-						return ErrCheckFailed
-					}
+		code := http.StatusOK
+		if eg.Wait() != nil {
+			code = http.StatusInternalServerError
+		}
 
-					return nil
-				})
-			}
-			err := eg.Wait()
-			return status.String(verbose), err
-		})
-		if err != nil {
-			c.Status(http.StatusInternalServerError)
-		} else {
-			c.Status(http.StatusOK)
+		if query.Get("format") == "json" {
+			c.Writer.Header().Set("Content-Type", "application/json")
+			c.Status(code)
+			_, _ = c.Writer.Write(status.JSON())
+			return
 		}
-		_, _ = c.Writer.WriteString(body.(string))
+		c.Status(code)
+		_, _ = c.Writer.WriteString(status.String(verbose))
 	}
 }
@@ -0,0 +1,218 @@
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/metrics"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+)
+
+// State is the health of a checker derived from its recent history.
+type State int
+
+const (
+	StateHealthy State = iota
+	StateDegraded
+	StateUnhealthy
+)
+
+func (s State) String() string {
+	switch s {
+	case StateHealthy:
+		return "healthy"
+	case StateDegraded:
+		return "degraded"
+	default:
+		return "unhealthy"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type ProbeConfig struct {
+	// Enable 后台周期性执行已注册的检查，/readyz 直接返回最近的检查结果
+	Enable bool `yaml:"enable"`
+	// Interval 检查间隔（秒），默认 10
+	Interval int `yaml:"interval"`
+	// HistorySize 每项检查保留的历史结果数量，默认 10
+	HistorySize int `yaml:"historySize"`
+	// DegradedThreshold 历史中失败次数达到该值时视为降级，默认 1
+	DegradedThreshold int `yaml:"degradedThreshold"`
+	// UnhealthyThreshold 连续失败次数达到该值时视为不健康，默认 3
+	UnhealthyThreshold int `yaml:"unhealthyThreshold"`
+}
+
+func (c ProbeConfig) withDefaults() ProbeConfig {
+	if c.Interval <= 0 {
+		c.Interval = 10
+	}
+	if c.HistorySize <= 0 {
+		c.HistorySize = 10
+	}
+	if c.DegradedThreshold <= 0 {
+		c.DegradedThreshold = 1
+	}
+	if c.UnhealthyThreshold <= 0 {
+		c.UnhealthyThreshold = 3
+	}
+	return c
+}
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_check_state",
+		Help: "State of background health checks: 0 healthy, 1 degraded, 2 unhealthy.",
+	}, []string{"check"})
+
+	transitionCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "health_check_transitions_total",
+		Help: "Number of state transitions of background health checks.",
+	}, []string{"check", "from", "to"})
+
+	checkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "health_check_duration_seconds",
+		Help:    "Latency of background health checks.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"check"})
+)
+
+func init() {
+	metrics.MustRegister(stateGauge, transitionCounter, checkDuration)
+}
+
+var (
+	prober   *probeRunner
+	proberMu sync.Mutex
+)
+
+type probeRunner struct {
+	config ProbeConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartProbing runs every registered checker in the background until
+// StopProbing is called.
+func StartProbing(config ProbeConfig) {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+	if prober != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	prober = &probeRunner{
+		config: config.withDefaults(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go prober.loop(ctx)
+}
+
+func StopProbing() {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+	if prober == nil {
+		return
+	}
+	prober.cancel()
+	<-prober.done
+	prober = nil
+}
+
+func probing() bool {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+	return prober != nil
+}
+
+func (p *probeRunner) loop(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(time.Duration(p.config.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, checker := range registeredCheckers() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				checker.probe(ctx, p.config)
+			}()
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe runs the checker, appends the result to its history and
+// re-evaluates its state. The check runs outside c.mu so probed never
+// waits for it.
+func (c *cachedChecker) probe(ctx context.Context, config ProbeConfig) {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	r := c.check(ctx)
+	checkDuration.WithLabelValues(c.Name()).Observe(r.Latency.Seconds())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = &r
+	c.history = append(c.history, r)
+	if len(c.history) > config.HistorySize {
+		c.history = c.history[len(c.history)-config.HistorySize:]
+	}
+
+	failures := lo.CountBy(c.history, func(r Result) bool {
+		return r.Status == StatusError
+	})
+	consecutive := 0
+	for i := len(c.history) - 1; i >= 0 && c.history[i].Status == StatusError; i-- {
+		consecutive++
+	}
+
+	state := StateHealthy
+	switch {
+	case consecutive >= config.UnhealthyThreshold:
+		state = StateUnhealthy
+	case failures >= config.DegradedThreshold:
+		state = StateDegraded
+	}
+	if c.optional() {
+		state = min(state, StateDegraded)
+	}
+
+	stateGauge.WithLabelValues(c.Name()).Set(float64(state))
+	if state != c.state {
+		transitionCounter.WithLabelValues(c.Name(), c.state.String(), state.String()).Inc()
+		log := logx.NameSpace("healthcheck")
+		if state > c.state {
+			log.Warnw("health check state changed", "check", c.Name(), "from", c.state, "to", state, "failures", failures, "message", r.Message)
+		} else {
+			log.Infow("health check state changed", "check", c.Name(), "from", c.state, "to", state, "failures", failures)
+		}
+		c.state = state
+	}
+}
+
+// probed returns the latest background result and state, ok is false if
+// the checker has not been probed yet.
+func (c *cachedChecker) probed() (r Result, state State, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil || len(c.history) == 0 {
+		return Result{}, StateHealthy, false
+	}
+	return *c.last, c.state, true
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/juanjiTech/jin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var defaultRegistry = prometheus.NewRegistry()
+
+func init() {
+	defaultRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MustRegister registers collectors to the registry served by /metrics.
+func MustRegister(cs ...prometheus.Collector) {
+	defaultRegistry.MustRegister(cs...)
+}
+
+func Register(e *jin.Engine) {
+	e.GET("/metrics", NewHandler())
+}
+
+func NewHandler() jin.HandlerFunc {
+	h := promhttp.HandlerFor(defaultRegistry, promhttp.HandlerOpts{
+		Registry:          defaultRegistry,
+		EnableOpenMetrics: true,
+	})
+	return func(c *jin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -2,52 +2,91 @@ package jinx
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/asjdf/lfs-s3/mod/jinx/accesslog"
 	"github.com/asjdf/lfs-s3/mod/jinx/healthcheck"
+	"github.com/asjdf/lfs-s3/mod/jinx/metrics"
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/asjdf/lfs-s3/mod/jinx/tlsx"
 	"github.com/juanjiTech/jframe/conf"
 	"github.com/juanjiTech/jframe/core/kernel"
 	"github.com/juanjiTech/jin"
-	"github.com/juanjiTech/jin/middleware/cors"
 	sentryjin "github.com/juanjiTech/sentry-jin"
 	"github.com/opentracing/opentracing-go"
 	"github.com/soheilhy/cmux"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
 )
 
 var _ kernel.Module = (*Mod)(nil)
 
+type Config struct {
+	AccessLog   accesslog.Config        `yaml:"accessLog"`
+	HealthCheck healthcheck.ProbeConfig `yaml:"healthCheck"`
+	TLS         tlsx.Config             `yaml:"tls"`
+	CORS        CORSConfig              `yaml:"cors"`
+}
+
 type Mod struct {
 	kernel.UnimplementedModule // 请为所有Module引入UnimplementedModule
 
+	config   Config
 	listener net.Listener
 	j        *jin.Engine
 	httpSrv  *http.Server
+	tls      *tlsx.Reloader
 }
 
 func (m *Mod) Name() string {
 	return "jinx"
 }
 
+func (m *Mod) Config() any {
+	return &m.config
+}
+
 func (m *Mod) Init(hub *kernel.Hub) error {
 	m.j = jin.New()
-	corsConf := cors.DefaultConfig()
-	corsConf.AllowAllOrigins = true
-	corsConf.AllowCredentials = true
-	corsConf.AddAllowHeaders("Authorization")
-	m.j.Use(
-		jin.Recovery(),
-		cors.New(corsConf),
-	)
+	// access log goes first so that requests recovered from panic are logged too
+	if m.config.AccessLog.Enable {
+		m.j.Use(accesslog.New(m.config.AccessLog))
+	}
+	m.j.Use(jin.Recovery())
+	if m.config.CORS.Enable {
+		corsHandler, err := newCORS(m.config.CORS)
+		if err != nil {
+			return err
+		}
+		m.j.Use(corsHandler)
+	}
 	if conf.Get().SentryDsn != "" {
 		m.j.Use(sentryjin.New(sentryjin.Options{Repanic: true}))
 	}
+	m.j.Use(requestid.New())
+
 	healthcheck.Register(m.j)
+	metrics.Register(m.j)
+
+	if m.config.TLS.Enable {
+		reloader, err := tlsx.NewReloader(m.config.TLS)
+		if err != nil {
+			return err
+		}
+		if err := reloader.Watch(); err != nil {
+			return err
+		}
+		m.tls = reloader
+		// grpcx checks it to serve gRPC over TLS instead of cleartext h2c
+		hub.Map(&m.tls)
+	}
 
 	hub.Map(&m.j)
 	return nil
@@ -68,25 +107,41 @@ func (m *Mod) Start(hub *kernel.Hub) error {
 		return errors.New("can't load tcpMux from kernel")
 	}
 
-	httpL := tcpMux.Match(cmux.HTTP1Fast(), cmux.HTTP2())
+	var httpL net.Listener
+	if m.tls != nil {
+		httpL = tls.NewListener(tcpMux.Match(cmux.TLS()), m.tls.TLSConfig())
+	} else {
+		httpL = tcpMux.Match(cmux.HTTP1Fast(), cmux.HTTP2())
+	}
 	m.listener = httpL
 
+	var handler http.Handler = m.j
+	// with TLS on gRPC shares the TLS connections and is handed over by content type
+	var grpcSrv *grpc.Server
+	if m.tls != nil && hub.Load(&grpcSrv) == nil {
+		handler = grpcHandler(grpcSrv, handler)
+	}
+
 	// check if tracer exist
 	var tracer opentracing.Tracer
 	if hub.Load(&tracer) != nil {
 		m.httpSrv = &http.Server{
-			Handler: m.j,
+			Handler: handler,
 		}
 	} else {
 		fmt.Println("tracer find in kernel, enable http tracing ...")
 		m.httpSrv = &http.Server{
 			Handler: otelhttp.NewHandler(
-				m.j,
+				handler,
 				"server",
 			),
 		}
 	}
 
+	if m.config.HealthCheck.Enable {
+		healthcheck.StartProbing(m.config.HealthCheck)
+	}
+
 	if err := m.httpSrv.Serve(httpL); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		hub.Log.Infow("failed to start to listen and serve", "error", err)
 	}
@@ -98,9 +153,26 @@ func (m *Mod) Stop(wg *sync.WaitGroup, ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	healthcheck.StopProbing()
+	if m.tls != nil {
+		_ = m.tls.Close()
+	}
+
 	if err := m.httpSrv.Shutdown(ctx); err != nil {
 		fmt.Println("Server forced to shutdown: " + err.Error())
 		return err
 	}
 	return nil
 }
+
+// grpcHandler serves gRPC requests, which are always HTTP/2, with srv and
+// everything else with next.
+func grpcHandler(srv *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			srv.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/juanjiTech/jin"
+	sentryjin "github.com/juanjiTech/sentry-jin"
+	"github.com/oklog/ulid/v2"
+)
+
+const Header = "X-Request-ID"
+
+const maxLength = 128
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, empty if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// New returns a middleware which assigns every request an ID, honoring a
+// well-formed incoming X-Request-ID, and echoes it in the response header.
+func New() jin.HandlerFunc {
+	return func(c *jin.Context) {
+		id := c.Request.Header.Get(Header)
+		if !valid(id) {
+			id = ulid.Make().String()
+			c.Request.Header.Set(Header, id)
+		}
+
+		c.Writer.Header().Set(Header, id)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		if hub := sentryjin.GetHubFromContext(c); hub != nil {
+			hub.Scope().SetTag("request_id", id)
+		}
+
+		c.Next()
+	}
+}
+
+// valid rejects IDs that are too long or may break log lines and headers.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+type Config struct {
+	Enable   bool   `yaml:"enable"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ClientCAFile 用于校验客户端证书的 CA 证书包，设置后启用双向 TLS
+	ClientCAFile string `yaml:"clientCAFile"`
+	// ClientAuth 客户端证书校验方式：optional（默认，提供了证书才校验）或 require
+	ClientAuth string `yaml:"clientAuth"`
+	// MinVersion 最低 TLS 版本：1.2（默认）或 1.3
+	MinVersion string `yaml:"minVersion"`
+	// CipherSuites 允许的加密套件名称，例如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，为空时使用 Go 默认值；TLS 1.3 不可配置
+	CipherSuites []string `yaml:"cipherSuites"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Reloader serves the certificate and client CA bundle read from disk and
+// reloads them whenever the files change. A failed reload keeps the
+// previous files in use.
+type Reloader struct {
+	config Config
+	base   *tls.Config
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+
+	watcher *fsnotify.Watcher
+}
+
+func NewReloader(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("tls certFile and keyFile are required")
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if config.MinVersion != "" {
+		v, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, errors.Errorf("unsupported tls minVersion: %s", config.MinVersion)
+		}
+		base.MinVersion = v
+	}
+	if len(config.CipherSuites) > 0 {
+		suites := lo.SliceToMap(tls.CipherSuites(), func(s *tls.CipherSuite) (string, uint16) {
+			return s.Name, s.ID
+		})
+		for _, name := range config.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, errors.Errorf("unsupported or insecure tls cipher suite: %s", name)
+			}
+			base.CipherSuites = append(base.CipherSuites, id)
+		}
+	}
+	if config.ClientCAFile != "" {
+		switch config.ClientAuth {
+		case "", "optional":
+			base.ClientAuth = tls.VerifyClientCertIfGiven
+		case "require":
+			base.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, errors.Errorf("unsupported tls clientAuth: %s", config.ClientAuth)
+		}
+	}
+
+	r := &Reloader{config: config, base: base}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "load tls key pair")
+	}
+
+	var pool *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "read tls client ca")
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in tls client ca file")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCA = pool
+	return nil
+}
+
+// Watch reloads the files on change until Close is called. The parent
+// directories are watched so that atomic replacement, such as Kubernetes
+// secret updates, is noticed too.
+func (r *Reloader) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create tls file watcher")
+	}
+	files := lo.Compact([]string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile})
+	for _, dir := range lo.Uniq(lo.Map(files, func(f string, _ int) string { return filepath.Dir(f) })) {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return errors.Wrap(err, "watch tls file directory")
+		}
+	}
+	r.watcher = watcher
+
+	// Kubernetes swaps secret contents through the "..data" symlink
+	relevant := func(name string) bool {
+		base := filepath.Base(name)
+		return strings.HasPrefix(base, "..") || lo.ContainsBy(files, func(f string) bool {
+			return filepath.Base(f) == base
+		})
+	}
+
+	log := logx.NameSpace("tls")
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Chmod) || !relevant(event.Name) {
+					continue
+				}
+				if err := r.reload(); err != nil {
+					log.Warnw("failed to reload tls files, keep using the previous ones", "event", event.String(), "error", err)
+					continue
+				}
+				log.Infow("tls files reloaded", "event", event.String())
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnw("tls file watcher error", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Reloader) Close() error {
+	if r.watcher == nil {
+		return nil
+	}
+	return r.watcher.Close()
+}
+
+// TLSConfig returns a config that always uses the latest loaded files.
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := r.base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		c := r.base.Clone()
+		c.Certificates = []tls.Certificate{*r.cert}
+		c.ClientCAs = r.clientCA
+		return c, nil
+	}
+	return config
+}
+
+// ClientIdentity returns the identity of the verified client certificate of
+// req, in the form of the subject common name, or "" if the client did not
+// present a verified certificate.
+func ClientIdentity(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := req.TLS.VerifiedChains[0][0]
+	if cn := strings.TrimSpace(leaf.Subject.CommonName); cn != "" {
+		return cn
+	}
+	return fmt.Sprint(leaf.Subject)
+}
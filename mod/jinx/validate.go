@@ -0,0 +1,27 @@
+package jinx
+
+import (
+	"github.com/asjdf/lfs-s3/mod/jinx/tlsx"
+	"github.com/pkg/errors"
+)
+
+// Validate checks the config without starting anything and returns every
+// problem found, each prefixed with the path of the offending field.
+func (c Config) Validate() []error {
+	var errs []error
+	if c.AccessLog.SampleRate < 0 || c.AccessLog.SampleRate > 1 {
+		errs = append(errs, errors.Errorf("accessLog.sampleRate: %v must be between 0 and 1", c.AccessLog.SampleRate))
+	}
+	if c.TLS.Enable {
+		// loading the reloader reads the key pair and client CA once
+		if _, err := tlsx.NewReloader(c.TLS); err != nil {
+			errs = append(errs, errors.Wrap(err, "tls"))
+		}
+	}
+	if c.CORS.Enable {
+		if _, err := newCORS(c.CORS); err != nil {
+			errs = append(errs, errors.Wrap(err, "cors"))
+		}
+	}
+	return errs
+}
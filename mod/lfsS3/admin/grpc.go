@@ -0,0 +1,248 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/admin/adminpb"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/locks"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var _ adminpb.AdminServiceServer = (*GRPCServer)(nil)
+
+// GRPCServer 将 Service 暴露为 gRPC 接口
+type GRPCServer struct {
+	adminpb.UnimplementedAdminServiceServer
+
+	service *Service
+	token   string
+}
+
+func NewGRPCServer(s *Service, token string) *GRPCServer {
+	return &GRPCServer{
+		service: s,
+		token:   token,
+	}
+}
+
+// AuthFuncOverride 校验 metadata 中的 Bearer Token，由 grpcx 的拦截器在调用前执行
+func (g *GRPCServer) AuthFuncOverride(ctx context.Context, _ string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && ValidToken(g.token, token) {
+			return ctx, nil
+		}
+	}
+	return ctx, status.Error(codes.Unauthenticated, "invalid admin token")
+}
+
+// ValidToken 以恒定时间比较令牌，未配置令牌时总是拒绝
+func ValidToken(expected, actual string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+func parseRepo(s string) (repo.Repo, error) {
+	r, err := repo.Parse(s)
+	if err != nil {
+		return repo.Repo{}, status.Errorf(codes.InvalidArgument, "invalid repo %q", s)
+	}
+	return r, nil
+}
+
+// parseOptionalRepo 解析可为空的仓库参数，为空时返回 nil 表示全部仓库
+func parseOptionalRepo(s string) (*repo.Repo, error) {
+	if s == "" {
+		return nil, nil
+	}
+	r, err := parseRepo(s)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrObjectNotFound), errors.Is(err, locks.ErrLockNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidOID):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrNotRepoScoped):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, locks.ErrLockExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func toPBObject(o Object) *adminpb.Object {
+	return &adminpb.Object{
+		Oid:          o.OID,
+		Size:         o.Size,
+		LastModified: timestamppb.New(o.LastModified),
+		StorageClass: o.StorageClass,
+	}
+}
+
+func toPBLock(l locks.Lock) *adminpb.Lock {
+	lock := &adminpb.Lock{
+		Id:       l.ID,
+		Path:     l.Path,
+		LockedAt: timestamppb.New(l.LockedAt),
+	}
+	if l.Owner != nil {
+		lock.Owner = l.Owner.Name
+	}
+	return lock
+}
+
+func toPBUsage(u Usage) *adminpb.Usage {
+	return &adminpb.Usage{
+		Repo:    u.Repo,
+		Objects: u.Objects,
+		Bytes:   u.Bytes,
+	}
+}
+
+func (g *GRPCServer) ListObjects(ctx context.Context, req *adminpb.ListObjectsRequest) (*adminpb.ListObjectsResponse, error) {
+	r, err := parseRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	pageSize := req.GetPageSize()
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	objects, next, err := g.service.ListObjects(ctx, r, req.GetPageToken(), pageSize)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &adminpb.ListObjectsResponse{NextPageToken: next}
+	for _, o := range objects {
+		resp.Objects = append(resp.Objects, toPBObject(o))
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) StatObject(ctx context.Context, req *adminpb.StatObjectRequest) (*adminpb.Object, error) {
+	r, err := parseRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	o, err := g.service.StatObject(ctx, r, req.GetOid())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toPBObject(o), nil
+}
+
+func (g *GRPCServer) DeleteObject(ctx context.Context, req *adminpb.DeleteObjectRequest) (*adminpb.DeleteObjectResponse, error) {
+	r, err := parseRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	if err := g.service.DeleteObject(ctx, r, req.GetOid()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &adminpb.DeleteObjectResponse{}, nil
+}
+
+func (g *GRPCServer) ListLocks(ctx context.Context, req *adminpb.ListLocksRequest) (*adminpb.ListLocksResponse, error) {
+	r, err := parseRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	ls, err := g.service.ListLocks(ctx, r)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &adminpb.ListLocksResponse{}
+	for _, l := range ls {
+		resp.Locks = append(resp.Locks, toPBLock(l))
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) CreateLock(ctx context.Context, req *adminpb.CreateLockRequest) (*adminpb.Lock, error) {
+	r, err := parseRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "path is required")
+	}
+	l, err := g.service.CreateLock(ctx, r, req.GetPath(), req.GetOwner())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toPBLock(l), nil
+}
+
+func (g *GRPCServer) DeleteLock(ctx context.Context, req *adminpb.DeleteLockRequest) (*adminpb.Lock, error) {
+	r, err := parseRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	l, err := g.service.DeleteLock(ctx, r, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toPBLock(l), nil
+}
+
+func (g *GRPCServer) InvalidateAuthCache(_ context.Context, req *adminpb.InvalidateAuthCacheRequest) (*adminpb.InvalidateAuthCacheResponse, error) {
+	r, err := parseOptionalRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+	return &adminpb.InvalidateAuthCacheResponse{Removed: int64(g.service.InvalidateAuthCache(r))}, nil
+}
+
+func (g *GRPCServer) GetStorageUsage(ctx context.Context, req *adminpb.GetStorageUsageRequest) (*adminpb.GetStorageUsageResponse, error) {
+	r, err := parseOptionalRepo(req.GetRepo())
+	if err != nil {
+		return nil, err
+	}
+
+	// 按仓库统计时只需扫描一次存储桶，总量由各仓库累加得到
+	if r == nil && req.GetPerRepo() {
+		repos, err := g.service.ListRepos(ctx)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		resp := &adminpb.GetStorageUsageResponse{Total: &adminpb.Usage{}}
+		for _, u := range repos {
+			resp.Total.Objects += u.Objects
+			resp.Total.Bytes += u.Bytes
+			resp.Repos = append(resp.Repos, toPBUsage(u))
+		}
+		return resp, nil
+	}
+
+	usage, err := g.service.Usage(ctx, r)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &adminpb.GetStorageUsageResponse{Total: toPBUsage(usage)}, nil
+}
@@ -0,0 +1,176 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/juanjiTech/jin"
+	"github.com/juanjiTech/jin/render"
+	"github.com/pkg/errors"
+)
+
+type errorResponse struct {
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type listReposResponse struct {
+	Repos []Usage `json:"repos"`
+	Total Usage   `json:"total"`
+}
+
+type listObjectsResponse struct {
+	Objects       []Object `json:"objects"`
+	NextPageToken string   `json:"next_page_token,omitempty"`
+}
+
+// HTTPServer 将 Service 暴露为 REST 接口，仓库通过查询参数 repo 指定以支持多级命名空间
+type HTTPServer struct {
+	service *Service
+	token   string
+}
+
+func NewHTTPServer(s *Service, token string) *HTTPServer {
+	return &HTTPServer{
+		service: s,
+		token:   token,
+	}
+}
+
+func (h *HTTPServer) RegisterRoutes(g *jin.RouterGroup) {
+	g.Use(h.authenticate)
+	g.GET("/repos", h.listRepos)
+	g.GET("/usage", h.usage)
+	g.GET("/objects", h.listObjects)
+	g.GET("/objects/:oid", h.statObject)
+	g.DELETE("/objects/:oid", h.deleteObject)
+}
+
+func (h *HTTPServer) authenticate(c *jin.Context) {
+	token, ok := strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	if !ok || !ValidToken(h.token, token) {
+		c.Writer.Header().Set("WWW-Authenticate", "Bearer")
+		renderError(c, http.StatusUnauthorized, "invalid admin token")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func renderError(c *jin.Context, code int, message string) {
+	c.Render(code, render.JSON{Data: errorResponse{
+		Message:   message,
+		RequestID: requestid.FromContext(c.Request.Context()),
+	}})
+}
+
+func renderServiceError(c *jin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrObjectNotFound):
+		renderError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, ErrInvalidOID):
+		renderError(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, storage.ErrNotRepoScoped):
+		renderError(c, http.StatusConflict, err.Error())
+		return
+	}
+	renderError(c, http.StatusInternalServerError, err.Error())
+}
+
+// queryRepo 解析查询参数中的仓库路径，失败时已写入错误响应
+func queryRepo(c *jin.Context) (repo.Repo, bool) {
+	r, err := repo.Parse(c.Request.URL.Query().Get("repo"))
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "invalid repo")
+		return repo.Repo{}, false
+	}
+	return r, true
+}
+
+func (h *HTTPServer) listRepos(c *jin.Context) {
+	repos, err := h.service.ListRepos(c.Request.Context())
+	if err != nil {
+		renderServiceError(c, err)
+		return
+	}
+	resp := listReposResponse{Repos: repos}
+	for _, u := range repos {
+		resp.Total.Objects += u.Objects
+		resp.Total.Bytes += u.Bytes
+	}
+	c.Render(http.StatusOK, render.JSON{Data: resp})
+}
+
+func (h *HTTPServer) usage(c *jin.Context) {
+	var r *repo.Repo
+	if c.Request.URL.Query().Get("repo") != "" {
+		parsed, ok := queryRepo(c)
+		if !ok {
+			return
+		}
+		r = &parsed
+	}
+	usage, err := h.service.Usage(c.Request.Context(), r)
+	if err != nil {
+		renderServiceError(c, err)
+		return
+	}
+	c.Render(http.StatusOK, render.JSON{Data: usage})
+}
+
+func (h *HTTPServer) listObjects(c *jin.Context) {
+	r, ok := queryRepo(c)
+	if !ok {
+		return
+	}
+	limit := int64(defaultPageSize)
+	if s := c.Request.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			renderError(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	objects, next, err := h.service.ListObjects(c.Request.Context(), r, c.Request.URL.Query().Get("page_token"), limit)
+	if err != nil {
+		renderServiceError(c, err)
+		return
+	}
+	c.Render(http.StatusOK, render.JSON{Data: listObjectsResponse{
+		Objects:       objects,
+		NextPageToken: next,
+	}})
+}
+
+func (h *HTTPServer) statObject(c *jin.Context) {
+	r, ok := queryRepo(c)
+	if !ok {
+		return
+	}
+	object, err := h.service.StatObject(c.Request.Context(), r, c.Params.ByName("oid"))
+	if err != nil {
+		renderServiceError(c, err)
+		return
+	}
+	c.Render(http.StatusOK, render.JSON{Data: object})
+}
+
+func (h *HTTPServer) deleteObject(c *jin.Context) {
+	r, ok := queryRepo(c)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteObject(c.Request.Context(), r, c.Params.ByName("oid")); err != nil {
+		renderServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
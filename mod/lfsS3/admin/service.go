@@ -0,0 +1,185 @@
+package admin
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/locks"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/auth"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/quota"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidOID = errors.New("invalid object id")
+
+type Object struct {
+	OID          string    `json:"oid"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	StorageClass string    `json:"storage_class,omitempty"`
+}
+
+type Usage struct {
+	Repo    string `json:"repo,omitempty"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Service 管理接口的业务实现，由 gRPC 与 HTTP 管理接口共用
+type Service struct {
+	storage    *storage.S3Storage
+	authorizer *auth.Authorizer
+	locks      *locks.Store
+	// layout 返回处理器当前使用的键布局，配置热加载后随之变化
+	layout func() *handler.Layout
+}
+
+func NewService(s *storage.S3Storage, a *auth.Authorizer, l *locks.Store, layout func() *handler.Layout) *Service {
+	return &Service{
+		storage:    s,
+		authorizer: a,
+		locks:      l,
+		layout:     layout,
+	}
+}
+
+func toObject(oid string, info storage.ObjectInfo) Object {
+	return Object{
+		OID:          oid,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		StorageClass: info.StorageClass,
+	}
+}
+
+// ListObjects 分页列举仓库的对象，只支持按仓库存放的布局
+func (s *Service) ListObjects(ctx context.Context, r repo.Repo, token string, limit int64) ([]Object, string, error) {
+	prefix, err := s.layout().Current().RepoPrefix(r)
+	if err != nil {
+		return nil, "", err
+	}
+	infos, next, err := s.storage.ListObjects(ctx, prefix, token, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	// 子命名空间下其他仓库的对象与非 LFS 对象不返回，因此一页中的对象数可能少于 limit
+	objects := make([]Object, 0, len(infos))
+	for _, info := range infos {
+		oid := strings.TrimPrefix(info.Key, prefix)
+		if !pointer.ValidOID(oid) {
+			continue
+		}
+		objects = append(objects, toObject(oid, info))
+	}
+	return objects, next, nil
+}
+
+// StatObject 返回下载时实际读取的对象，双读期间可能位于旧布局中
+func (s *Service) StatObject(ctx context.Context, r repo.Repo, oid string) (Object, error) {
+	if !pointer.ValidOID(oid) {
+		return Object{}, ErrInvalidOID
+	}
+	store, key := s.layout().Locate(ctx, s.storage, r, oid)
+	info, err := store.StatObject(ctx, key)
+	if err != nil {
+		return Object{}, err
+	}
+	return toObject(oid, info), nil
+}
+
+// DeleteObject 删除对象在当前布局与双读旧布局中的副本；按内容寻址时对象在仓库间共享，
+// 删除会影响所有引用该对象的仓库
+func (s *Service) DeleteObject(ctx context.Context, r repo.Repo, oid string) error {
+	if !pointer.ValidOID(oid) {
+		return ErrInvalidOID
+	}
+	deleted := false
+	for _, loc := range s.layout().Locations(s.storage, r, oid) {
+		_, err := loc.Storage.StatObject(ctx, loc.Key)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := loc.Storage.DeleteObject(ctx, loc.Key); err != nil {
+			return err
+		}
+		deleted = true
+	}
+	if !deleted {
+		return storage.ErrObjectNotFound
+	}
+	return nil
+}
+
+// ListRepos 扫描整个存储桶，按对象所在的键前缀统计每个仓库的用量，只支持按仓库存放的布局
+func (s *Service) ListRepos(ctx context.Context) ([]Usage, error) {
+	if !s.layout().Current().RepoScoped() {
+		return nil, storage.ErrNotRepoScoped
+	}
+	usages, err := quota.Scan(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]Usage, 0, len(usages))
+	for name, u := range usages {
+		repos = append(repos, Usage{Repo: name, Objects: u.Objects, Bytes: u.Bytes})
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Repo < repos[j].Repo
+	})
+	return repos, nil
+}
+
+// Usage 统计当前布局下单个仓库的用量，r 为 nil 时统计整个存储桶（不含服务自身的保留数据）；
+// 按内容寻址时只能统计整个存储桶
+func (s *Service) Usage(ctx context.Context, r *repo.Repo) (Usage, error) {
+	layout := s.layout().Current()
+	var usage Usage
+	prefix := layout.Prefix()
+	if r != nil {
+		usage.Repo = r.String()
+		var err error
+		if prefix, err = layout.RepoPrefix(*r); err != nil {
+			return Usage{}, err
+		}
+	}
+	err := s.storage.WalkObjects(ctx, prefix, func(info storage.ObjectInfo) error {
+		objRepo, _, ok := layout.ParseKey(info.Key)
+		if !ok {
+			return nil
+		}
+		// 子命名空间下其他仓库的对象不计入
+		if r != nil && objRepo.String() != r.String() {
+			return nil
+		}
+		usage.Objects++
+		usage.Bytes += info.Size
+		return nil
+	})
+	return usage, err
+}
+
+func (s *Service) ListLocks(ctx context.Context, r repo.Repo) ([]locks.Lock, error) {
+	return s.locks.List(ctx, r)
+}
+
+func (s *Service) CreateLock(ctx context.Context, r repo.Repo, path, owner string) (locks.Lock, error) {
+	return s.locks.Create(ctx, r, path, owner)
+}
+
+func (s *Service) DeleteLock(ctx context.Context, r repo.Repo, id string) (locks.Lock, error) {
+	return s.locks.Delete(ctx, r, id, "", true)
+}
+
+func (s *Service) InvalidateAuthCache(r *repo.Repo) int {
+	return s.authorizer.InvalidateCache(r)
+}
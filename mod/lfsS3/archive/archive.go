@@ -0,0 +1,288 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/klauspost/compress/zstd"
+	"github.com/oklog/ulid/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ManifestName 清单在归档中的路径，总是归档的第一个条目
+	ManifestName = "manifest.json"
+	// objectsDir 对象在归档中的目录，与 Git LFS 本地存储一致：objects/<OID[0:2]>/<OID[2:4]>/<OID>
+	objectsDir      = "objects/"
+	manifestVersion = 1
+	// stagingPrefix 导入时校验前的临时键前缀
+	stagingPrefix = storage.ReservedPrefix + "import/"
+)
+
+// zstdMagic zstd 帧的起始字节，导入时据此判断归档是否经过压缩
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+type Manifest struct {
+	Version   int       `json:"version"`
+	Repo      string    `json:"repo"`
+	CreatedAt time.Time `json:"created_at"`
+	Objects   []Object  `json:"objects"`
+}
+
+type Object struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type Result struct {
+	Objects int64
+	Bytes   int64
+	// Skipped 导入时存储中已存在的对象
+	Skipped int64
+}
+
+type ExportOptions struct {
+	Repo repo.Repo
+	// Layout 服务使用的键布局，只支持当前布局按仓库存放，只导出当前布局中的对象
+	Layout *handler.Layout
+	// Compress 使用 zstd 压缩归档
+	Compress bool
+	// OnObject 每写入一个对象后调用
+	OnObject func(Object)
+}
+
+// Export 将仓库的全部对象连同清单以 tar 格式流式写入 w，子命名空间下的仓库不包含在内
+func Export(ctx context.Context, s *storage.S3Storage, w io.Writer, opts ExportOptions) (*Result, error) {
+	// 按内容寻址时无法得知对象属于哪些仓库
+	prefix, err := opts.Layout.Current().RepoPrefix(opts.Repo)
+	if err != nil {
+		return nil, err
+	}
+	manifest := Manifest{Version: manifestVersion, Repo: opts.Repo.String(), CreatedAt: time.Now().UTC()}
+	err = s.WalkObjects(ctx, prefix, func(info storage.ObjectInfo) error {
+		oid := strings.TrimPrefix(info.Key, prefix)
+		if pointer.ValidOID(oid) {
+			manifest.Objects = append(manifest.Objects, Object{OID: oid, Size: info.Size})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Compress {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, errors.Wrap(err, "create zstd writer")
+		}
+		defer zw.Close()
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, ManifestName, int64(len(data)), manifest.CreatedAt, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, obj := range manifest.Objects {
+		body, err := s.GetObject(ctx, opts.Layout.Key(opts.Repo, obj.OID))
+		if err != nil {
+			return result, errors.Wrapf(err, "get %s", obj.OID)
+		}
+		// 对象在导出期间被修改时写入的长度与清单不一致，tar 会返回错误
+		err = writeEntry(tw, objectPath(obj.OID), obj.Size, manifest.CreatedAt, body)
+		body.Close()
+		if err != nil {
+			return result, errors.Wrapf(err, "write %s", obj.OID)
+		}
+		result.Objects++
+		result.Bytes += obj.Size
+		if opts.OnObject != nil {
+			opts.OnObject(obj)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return result, errors.Wrap(err, "close tar")
+	}
+	return result, nil
+}
+
+type ImportOptions struct {
+	// Repo 导入到该仓库，为 nil 时使用清单中的仓库
+	Repo *repo.Repo
+	// Layout 服务使用的键布局，对象写入当前布局，双读期间已存在于旧布局中的对象同样会被跳过
+	Layout *handler.Layout
+	// OnObject 每导入或跳过一个对象后调用
+	OnObject func(obj Object, skipped bool)
+}
+
+// Import 读取 Export 生成的归档（可以经过 zstd 压缩）并写入存储，写入时校验大小与 SHA-256，
+// 校验失败的对象会被删除；存储中已存在且大小一致的对象会被跳过
+func Import(ctx context.Context, s *storage.S3Storage, r io.Reader, opts ImportOptions) (*Manifest, *Result, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(zstdMagic)); bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create zstd reader")
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+
+	manifest, err := readManifest(tr)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := opts.Repo
+	if target == nil {
+		parsed, err := repo.Parse(manifest.Repo)
+		if err != nil {
+			return manifest, nil, errors.Wrapf(err, "invalid repo %q in manifest", manifest.Repo)
+		}
+		target = &parsed
+	}
+	expected := make(map[string]int64, len(manifest.Objects))
+	for _, obj := range manifest.Objects {
+		if !pointer.ValidOID(obj.OID) || obj.Size < 0 {
+			return manifest, nil, errors.Errorf("invalid object %s in manifest", obj.OID)
+		}
+		expected[obj.OID] = obj.Size
+	}
+
+	result := &Result{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, result, errors.Wrap(err, "read tar")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		oid, ok := entryOID(hdr.Name)
+		if !ok {
+			return manifest, result, errors.Errorf("unexpected entry %s", hdr.Name)
+		}
+		size, ok := expected[oid]
+		if !ok {
+			return manifest, result, errors.Errorf("object %s is not in the manifest", oid)
+		}
+		if hdr.Size != size {
+			return manifest, result, errors.Errorf("object %s has %d bytes, the manifest says %d", oid, hdr.Size, size)
+		}
+		delete(expected, oid)
+
+		obj := Object{OID: oid, Size: size}
+		skipped, err := importObject(ctx, s, opts.Layout, *target, obj, tr)
+		if err != nil {
+			return manifest, result, errors.Wrapf(err, "import %s", oid)
+		}
+		if skipped {
+			result.Skipped++
+		} else {
+			result.Objects++
+			result.Bytes += size
+		}
+		if opts.OnObject != nil {
+			opts.OnObject(obj, skipped)
+		}
+	}
+	if len(expected) > 0 {
+		return manifest, result, errors.Errorf("%d objects in the manifest are missing from the archive", len(expected))
+	}
+	return manifest, result, nil
+}
+
+// importObject 先写入保留前缀下的临时键，校验通过后再复制到目标键，避免不完整或损坏的内容被下载；
+// 临时键包含随机部分，同时导入相同对象时互不影响
+func importObject(ctx context.Context, s *storage.S3Storage, layout *handler.Layout, r repo.Repo, obj Object, body io.Reader) (bool, error) {
+	store, key := layout.Locate(ctx, s, r, obj.OID)
+	if info, err := store.StatObject(ctx, key); err == nil && info.Size == obj.Size {
+		return true, nil
+	} else if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return false, err
+	}
+
+	staging := stagingPrefix + ulid.Make().String() + "/" + obj.OID
+	defer func() { _ = s.DeleteObject(context.WithoutCancel(ctx), staging) }()
+	h := sha256.New()
+	if err := s.UploadObject(ctx, staging, io.TeeReader(body, h)); err != nil {
+		return false, err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != obj.OID {
+		return false, errors.Errorf("content hashes to %s", sum)
+	}
+	return false, s.CopyObject(ctx, s.BucketName(), staging, layout.Key(r, obj.OID), obj.Size)
+}
+
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "read tar")
+	}
+	if hdr.Name != ManifestName {
+		return nil, errors.Errorf("the first entry is %s, expected %s", hdr.Name, ManifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "parse manifest")
+	}
+	if manifest.Version != manifestVersion {
+		return nil, errors.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// entryOID 返回对象条目的 OID，条目名必须是 objectPath 生成的路径且 OID 有效
+func entryOID(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, objectsDir)
+	if !ok {
+		return "", false
+	}
+	oid := path.Base(rest)
+	if !pointer.ValidOID(oid) || name != objectPath(oid) {
+		return "", false
+	}
+	return oid, true
+}
+
+// objectPath 返回对象在归档中的路径，oid 必须有效
+func objectPath(oid string) string {
+	return objectsDir + oid[0:2] + "/" + oid[2:4] + "/" + oid
+}
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	oid1 = strings.Repeat("0123456789abcdef", 4)
+	oid2 = strings.Repeat("fedcba9876543210", 4)
+)
+
+func TestEntryOID(t *testing.T) {
+	tests := []struct {
+		name string
+		oid  string
+		ok   bool
+	}{
+		{name: objectPath(oid1), oid: oid1, ok: true},
+		{name: "objects/01/23/" + oid1, oid: oid1, ok: true},
+		{name: "objects/a"},
+		{name: "objects/"},
+		{name: "objects/01/23/" + strings.ToUpper(oid1)},
+		{name: "objects/ab/cd/" + oid1},
+		{name: "objects/" + oid1},
+		{name: "other/01/23/" + oid1},
+		{name: "objects/01/23/../23/" + oid1},
+		{name: "/objects/01/23/" + oid1},
+		{name: ManifestName},
+	}
+	for _, tt := range tests {
+		oid, ok := entryOID(tt.name)
+		if ok != tt.ok || oid != tt.oid {
+			t.Errorf("entryOID(%q) = %q, %v, want %q, %v", tt.name, oid, ok, tt.oid, tt.ok)
+		}
+	}
+}
+
+type entry struct {
+	name string
+	body string
+}
+
+func buildArchive(t *testing.T, manifest any, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if manifest != nil {
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append([]entry{{name: ManifestName, body: string(data)}}, entries...)
+	}
+	for _, e := range entries {
+		if err := writeEntry(tw, e.name, int64(len(e.body)), time.Now(), strings.NewReader(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestImportInvalid 覆盖在写入存储之前就能发现的错误，因此不需要存储
+func TestImportInvalid(t *testing.T) {
+	valid := Manifest{Version: manifestVersion, Repo: "owner/name", Objects: []Object{{OID: oid1, Size: 4}}}
+	tests := []struct {
+		name    string
+		archive []byte
+		err     string
+	}{
+		{name: "empty", archive: nil, err: "read tar"},
+		{name: "no manifest", archive: buildArchive(t, nil, entry{name: objectPath(oid1), body: "data"}), err: "the first entry is"},
+		{name: "corrupt manifest", archive: buildArchive(t, nil, entry{name: ManifestName, body: "{"}), err: "parse manifest"},
+		{name: "unsupported version", archive: buildArchive(t, Manifest{Version: 2, Repo: "owner/name"}), err: "unsupported manifest version"},
+		{name: "invalid repo", archive: buildArchive(t, Manifest{Version: manifestVersion, Repo: "name"}), err: "invalid repo"},
+		{
+			name:    "invalid oid in manifest",
+			archive: buildArchive(t, Manifest{Version: manifestVersion, Repo: "owner/name", Objects: []Object{{OID: "a", Size: 1}}}),
+			err:     "invalid object a in manifest",
+		},
+		{
+			name:    "negative size in manifest",
+			archive: buildArchive(t, Manifest{Version: manifestVersion, Repo: "owner/name", Objects: []Object{{OID: oid1, Size: -1}}}),
+			err:     "invalid object",
+		},
+		{name: "short entry name", archive: buildArchive(t, valid, entry{name: "objects/a", body: "data"}), err: "unexpected entry objects/a"},
+		{name: "unknown entry", archive: buildArchive(t, valid, entry{name: "README", body: "data"}), err: "unexpected entry README"},
+		{name: "object not in manifest", archive: buildArchive(t, valid, entry{name: objectPath(oid2), body: "data"}), err: "is not in the manifest"},
+		{name: "size mismatch", archive: buildArchive(t, valid, entry{name: objectPath(oid1), body: "longer"}), err: "the manifest says 4"},
+		{name: "missing objects", archive: buildArchive(t, valid), err: "1 objects in the manifest are missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Import(context.Background(), nil, bytes.NewReader(tt.archive), ImportOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Import() error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestImportCompressed(t *testing.T) {
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(buildArchive(t, Manifest{Version: manifestVersion, Repo: "group/sub/name"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, result, err := Import(context.Background(), nil, &buf, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Repo != "group/sub/name" || *result != (Result{}) {
+		t.Errorf("Import() = %+v, %+v", manifest, result)
+	}
+
+	// 指定的仓库覆盖清单中的仓库，清单中的仓库无效也不影响导入
+	target := repo.Repo{Owner: "owner", Name: "name"}
+	archive := buildArchive(t, Manifest{Version: manifestVersion, Repo: "invalid"})
+	if _, _, err := Import(context.Background(), nil, bytes.NewReader(archive), ImportOptions{Repo: &target}); err != nil {
+		t.Errorf("Import() with a target repo = %v, want nil", err)
+	}
+}
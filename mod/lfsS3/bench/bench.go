@@ -0,0 +1,473 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/pkg/errors"
+)
+
+const (
+	OperationUpload   = "upload"
+	OperationDownload = "download"
+	// OperationMixed 每次批量请求随机选择上传或下载
+	OperationMixed = "mixed"
+)
+
+type Phase string
+
+const (
+	// PhaseBatch 客户端观测到的批量请求耗时
+	PhaseBatch Phase = "batch"
+	// PhaseAuth 服务端通过 Server-Timing 响应头返回的鉴权耗时
+	PhaseAuth Phase = "auth"
+	// PhaseTransfer 单个对象通过预签名地址上传（含校验）或下载的耗时
+	PhaseTransfer Phase = "transfer"
+)
+
+// Phases 按报告顺序排列的阶段
+var Phases = []Phase{PhaseBatch, PhaseAuth, PhaseTransfer}
+
+type Options struct {
+	// URL LFS 接口地址（包含挂载前缀），如 https://lfs.example.com/lfs
+	URL       string
+	Repos     []repo.Repo
+	Operation string
+	// Objects 每次批量请求的对象数
+	Objects    int
+	ObjectSize int64
+	// Concurrency 并发发起批量请求的数量
+	Concurrency int
+	// Duration 压测时长，到达后不再发起新的批量请求
+	Duration time.Duration
+	// Requests 批量请求总数，为 0 时只受 Duration 限制
+	Requests int64
+	// Transfer 是否通过返回的预签名地址实际传输对象
+	Transfer bool
+	// PoolSize 压测开始前预先生成的对象数，避免计算哈希影响压测结果，
+	// 用完后循环使用（对象已存在时服务端不再返回上传地址），为 0 时按请求数与并发数估算
+	PoolSize int
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// Stats 一个阶段的统计
+type Stats struct {
+	Count  int64
+	Errors int64
+	// Skipped 无需传输的对象数，例如上传时对象已存在，不计入耗时与吞吐
+	Skipped   int64
+	Bytes     int64
+	LastError string
+	latencies []time.Duration
+}
+
+// Percentile 返回成功请求耗时的 p 分位数，p 取值 0~100
+func (s *Stats) Percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(s.latencies)-1) * p / 100)
+	return s.latencies[i]
+}
+
+type Report struct {
+	Elapsed time.Duration
+	Phases  map[Phase]*Stats
+}
+
+// object 压测生成的对象，内容由种子确定，无需保存在内存中
+type object struct {
+	oid  string
+	size int64
+	seed [32]byte
+}
+
+func (o object) content() io.Reader {
+	return io.LimitReader(rand.NewChaCha8(o.seed), o.size)
+}
+
+func newObject(size int64) object {
+	o := object{size: size}
+	for i := 0; i < len(o.seed); i += 8 {
+		v := rand.Uint64()
+		for j := range 8 {
+			o.seed[i+j] = byte(v >> (8 * j))
+		}
+	}
+	h := sha256.New()
+	_, _ = io.Copy(h, o.content())
+	o.oid = hex.EncodeToString(h.Sum(nil))
+	return o
+}
+
+type bench struct {
+	opts   Options
+	client *http.Client
+
+	// generated 预先生成的对象，next 为下一个取用的位置
+	generated []object
+	next      atomic.Int64
+
+	mu     sync.Mutex
+	phases map[Phase]*Stats
+	// uploaded 本次压测中已上传的对象，供下载使用
+	uploaded map[string][]object
+}
+
+// Run 向运行中的服务发起合成的批量请求，返回各阶段的吞吐与耗时分布
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if len(opts.Repos) == 0 {
+		return nil, errors.New("at least one repository is required")
+	}
+	switch opts.Operation {
+	case OperationUpload, OperationDownload, OperationMixed:
+	default:
+		return nil, errors.Errorf("unsupported operation %q", opts.Operation)
+	}
+	b := &bench{
+		opts:     opts,
+		client:   opts.Client,
+		phases:   map[Phase]*Stats{},
+		uploaded: map[string][]object{},
+	}
+	if b.client == nil {
+		b.client = http.DefaultClient
+	}
+	for _, p := range Phases {
+		b.phases[p] = &Stats{}
+	}
+	b.generate(opts.PoolSize)
+
+	// 只下载时先为每个仓库上传一批对象，不计入统计
+	if opts.Operation == OperationDownload && opts.Transfer {
+		for _, r := range opts.Repos {
+			if err := b.seed(ctx, r); err != nil {
+				return nil, errors.Wrapf(err, "seed %s", r)
+			}
+		}
+	}
+
+	start := time.Now()
+	deadline := start.Add(opts.Duration)
+	var issued atomic.Int64
+	var wg sync.WaitGroup
+	for range max(opts.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && time.Now().Before(deadline) {
+				if opts.Requests > 0 && issued.Add(1) > opts.Requests {
+					return
+				}
+				b.iteration(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 被中断时同样返回已完成部分的统计
+	report := &Report{Elapsed: time.Since(start), Phases: b.phases}
+	for _, s := range report.Phases {
+		slices.Sort(s.latencies)
+	}
+	return report, ctx.Err()
+}
+
+func (b *bench) iteration(ctx context.Context) {
+	r := b.opts.Repos[rand.IntN(len(b.opts.Repos))]
+	operation := b.opts.Operation
+	if operation == OperationMixed {
+		operation = []string{OperationUpload, OperationDownload}[rand.IntN(2)]
+		// 传输对象时只能下载已上传的对象，仓库中还没有对象时先上传
+		if operation == OperationDownload && b.opts.Transfer && len(b.pool(r)) == 0 {
+			operation = OperationUpload
+		}
+	}
+
+	objects := b.objects(r, operation)
+	resp, err := b.batch(ctx, r, operation, objects)
+	if err != nil || !b.opts.Transfer {
+		return
+	}
+	for i, obj := range resp.Objects {
+		if obj.Error != nil {
+			b.record(PhaseTransfer, 0, 0, errors.Errorf("object error %d: %s", obj.Error.Code, obj.Error.Message))
+			continue
+		}
+		// 对象池循环使用后重复上传的对象已存在，服务端不再返回上传地址
+		if operation == OperationUpload && obj.Actions.Upload == nil {
+			b.skip(PhaseTransfer)
+			continue
+		}
+		start := time.Now()
+		err := b.transfer(ctx, r, operation, objects[i], obj)
+		b.record(PhaseTransfer, time.Since(start), objects[i].size, err)
+		if err == nil && operation == OperationUpload {
+			b.mu.Lock()
+			b.uploaded[r.String()] = append(b.uploaded[r.String()], objects[i])
+			b.mu.Unlock()
+		}
+	}
+}
+
+// objects 上传时生成新对象，下载时优先选择本次压测已上传的对象
+func (b *bench) objects(r repo.Repo, operation string) []object {
+	objects := make([]object, b.opts.Objects)
+	var pool []object
+	if operation == OperationDownload {
+		pool = b.pool(r)
+	}
+	for i := range objects {
+		if len(pool) > 0 {
+			objects[i] = pool[rand.IntN(len(pool))]
+		} else {
+			objects[i] = b.generated[(b.next.Add(1)-1)%int64(len(b.generated))]
+		}
+	}
+	return objects
+}
+
+// generate 并行生成 n 个对象，n 为 0 时足够 Requests 次请求使用，未限制请求数时为每个并发预留 16 次请求
+func (b *bench) generate(n int) {
+	if n <= 0 {
+		requests := int64(max(b.opts.Concurrency, 1) * 16)
+		if b.opts.Requests > 0 {
+			requests = b.opts.Requests
+		}
+		// 只下载时仅需为每个仓库上传一批对象
+		if b.opts.Operation == OperationDownload {
+			requests = int64(len(b.opts.Repos))
+		}
+		n = int(requests) * max(b.opts.Objects, 1)
+	}
+	b.generated = make([]object, n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := next.Add(1) - 1; i < int64(n); i = next.Add(1) - 1 {
+				b.generated[i] = newObject(b.opts.ObjectSize)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (b *bench) pool(r repo.Repo) []object {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.uploaded[r.String()]
+}
+
+func (b *bench) seed(ctx context.Context, r repo.Repo) error {
+	objects := b.objects(r, OperationUpload)
+	resp, err := b.send(ctx, r, OperationUpload, objects)
+	if err != nil {
+		return err
+	}
+	for i, obj := range resp.Objects {
+		if obj.Error != nil {
+			return errors.Errorf("%s: %s", obj.OID, obj.Error.Message)
+		}
+		if err := b.transfer(ctx, r, OperationUpload, objects[i], obj); err != nil {
+			return err
+		}
+	}
+	b.uploaded[r.String()] = objects
+	return nil
+}
+
+// batch 发起批量请求并记录批量请求与鉴权的耗时
+func (b *bench) batch(ctx context.Context, r repo.Repo, operation string, objects []object) (*handler.LFSBatchResponse, error) {
+	start := time.Now()
+	resp, auth, err := b.request(ctx, r, operation, objects)
+	b.record(PhaseBatch, time.Since(start), 0, err)
+	if auth >= 0 {
+		b.record(PhaseAuth, auth, 0, nil)
+	}
+	return resp, err
+}
+
+func (b *bench) send(ctx context.Context, r repo.Repo, operation string, objects []object) (*handler.LFSBatchResponse, error) {
+	resp, _, err := b.request(ctx, r, operation, objects)
+	return resp, err
+}
+
+// request 发起批量请求，同时返回服务端的鉴权耗时，响应中没有时为 -1
+func (b *bench) request(ctx context.Context, r repo.Repo, operation string, objects []object) (*handler.LFSBatchResponse, time.Duration, error) {
+	batch := handler.LFSBatchRequest{Operation: operation, Transfers: []string{"basic"}, HashAlgo: handler.HashAlgoSHA256}
+	for _, o := range objects {
+		batch.Objects = append(batch.Objects, handler.LFSObject{OID: o.oid, Size: o.size})
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, -1, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.opts.URL+"/"+r.String()+"/info/lfs/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, -1, err
+	}
+	req.Header.Set("Accept", handler.ContentType)
+	req.Header.Set("Content-Type", handler.ContentType)
+	b.authenticate(req)
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer res.Body.Close()
+	auth := parseServerTiming(res.Header.Get(handler.ServerTimingHeader), "auth")
+	if res.StatusCode != http.StatusOK {
+		var respErr handler.LFSResponseError
+		_ = json.NewDecoder(res.Body).Decode(&respErr)
+		return nil, auth, errors.Errorf("batch responded with status %d: %s", res.StatusCode, respErr.Message)
+	}
+	var resp handler.LFSBatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, auth, errors.Wrap(err, "decode batch response")
+	}
+	if len(resp.Objects) != len(objects) {
+		return nil, auth, errors.Errorf("batch responded with %d objects, expected %d", len(resp.Objects), len(objects))
+	}
+	return &resp, auth, nil
+}
+
+// transfer 通过预签名地址上传并校验或下载对象
+func (b *bench) transfer(ctx context.Context, r repo.Repo, operation string, o object, obj handler.LFSObjectResponse) error {
+	if operation == OperationDownload {
+		if obj.Actions.Download == nil {
+			return errors.New("no download action")
+		}
+		res, err := b.do(ctx, http.MethodGet, obj.Actions.Download, nil, -1, false)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		n, err := io.Copy(io.Discard, res.Body)
+		if err != nil {
+			return errors.Wrap(err, "download")
+		}
+		if n != o.size {
+			return errors.Errorf("downloaded %d bytes, expected %d", n, o.size)
+		}
+		return nil
+	}
+
+	// 对象已存在时服务端不返回上传地址
+	if obj.Actions.Upload == nil {
+		return nil
+	}
+	res, err := b.do(ctx, http.MethodPut, obj.Actions.Upload, o.content(), o.size, false)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if obj.Actions.Verify == nil {
+		return nil
+	}
+	body, _ := json.Marshal(handler.LFSObject{OID: o.oid, Size: o.size})
+	// 校验接口位于服务本身，需要与批量请求相同的凭据
+	res, err = b.do(ctx, http.MethodPost, obj.Actions.Verify, bytes.NewReader(body), int64(len(body)), true)
+	if err != nil {
+		return errors.Wrap(err, "verify")
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (b *bench) do(ctx context.Context, method string, action *handler.LFSObjectAction, body io.Reader, size int64, authenticate bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, action.Href, body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+	if authenticate {
+		req.Header.Set("Content-Type", handler.ContentType)
+		if req.Header.Get("Authorization") == "" {
+			b.authenticate(req)
+		}
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		res.Body.Close()
+		return nil, errors.Errorf("%s responded with status %d", method, res.StatusCode)
+	}
+	return res, nil
+}
+
+func (b *bench) authenticate(req *http.Request) {
+	if b.opts.Username != "" || b.opts.Password != "" {
+		req.SetBasicAuth(b.opts.Username, b.opts.Password)
+	}
+}
+
+func (b *bench) record(phase Phase, d time.Duration, size int64, err error) {
+	// 中断时未完成的请求不计入统计
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.phases[phase]
+	s.Count++
+	if err != nil {
+		s.Errors++
+		s.LastError = err.Error()
+		return
+	}
+	s.Bytes += size
+	s.latencies = append(s.latencies, d)
+}
+
+func (b *bench) skip(phase Phase) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.phases[phase].Skipped++
+}
+
+// parseServerTiming 返回 Server-Timing 响应头中指定项的耗时，不存在时为 -1
+func parseServerTiming(header, name string) time.Duration {
+	for _, metric := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(metric), ";")
+		if params[0] != name {
+			continue
+		}
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "dur="); ok {
+				ms, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return -1
+				}
+				return time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+	}
+	return -1
+}
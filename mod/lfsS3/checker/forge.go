@@ -0,0 +1,58 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/healthcheck"
+)
+
+var (
+	_ healthcheck.Checker         = (*forge)(nil)
+	_ healthcheck.TimeoutChecker  = (*forge)(nil)
+	_ healthcheck.OptionalChecker = (*forge)(nil)
+)
+
+// NewForge 检查上游代码托管平台是否可访问，鉴权依赖该平台；
+// 平台不可访问时只将服务标记为降级，已缓存的鉴权结果仍然可用，不应让实例退出负载均衡
+func NewForge(url string) healthcheck.Checker {
+	return &forge{url: url}
+}
+
+type forge struct {
+	url string
+}
+
+func (f *forge) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, f.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// 只关心平台是否存活，4xx 也说明平台可以正常响应
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("forge responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Timeout 访问外网比访问存储慢，给予更宽松的超时
+func (f *forge) Timeout() time.Duration {
+	return 10 * time.Second
+}
+
+// Optional 平台不可访问时服务处于降级状态而非未就绪
+func (f *forge) Optional() bool {
+	return true
+}
+
+func (f *forge) Name() string {
+	return "forge"
+}
@@ -0,0 +1,58 @@
+package checker
+
+import (
+	"context"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/healthcheck"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+)
+
+// 用于预签名检查的对象键，只生成URL，不会真正访问该对象
+const presignProbeKey = storage.ReservedPrefix + "healthcheck"
+
+var (
+	_ healthcheck.Checker = (*bucket)(nil)
+	_ healthcheck.Checker = (*presign)(nil)
+)
+
+// NewBucket 检查存储桶是否可以通过内部客户端访问
+func NewBucket(s *storage.S3Storage) healthcheck.Checker {
+	return &bucket{storage: s}
+}
+
+type bucket struct {
+	storage *storage.S3Storage
+}
+
+func (b *bucket) Check(ctx context.Context) error {
+	return b.storage.BucketReachable(ctx)
+}
+
+func (b *bucket) Name() string {
+	return "s3-bucket"
+}
+
+// NewPresign 检查是否能够生成上传和下载的预签名URL
+func NewPresign(s *storage.S3Storage) healthcheck.Checker {
+	return &presign{storage: s}
+}
+
+type presign struct {
+	storage *storage.S3Storage
+}
+
+func (p *presign) Check(ctx context.Context) error {
+	if _, err := p.storage.GetObjectDownloadURL(ctx, presignProbeKey, time.Minute); err != nil {
+		return errors.Wrap(err, "presign download")
+	}
+	if _, err := p.storage.GetObjectUploadURL(ctx, presignProbeKey, time.Minute); err != nil {
+		return errors.Wrap(err, "presign upload")
+	}
+	return nil
+}
+
+func (p *presign) Name() string {
+	return "s3-presign"
+}
@@ -0,0 +1,32 @@
+package lfsS3
+
+import (
+	"github.com/asjdf/lfs-s3/pkg/envconf"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// LoadConfig 从配置文件与环境变量中读取 lfsS3 模块的配置，供不启动服务的命令行工具使用，
+// path 为空时与服务一致，在当前目录与 ./config 下查找 config.yaml
+func LoadConfig(path string) (Config, error) {
+	v := viper.New()
+	if path == "" {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("./config")
+	} else {
+		v.SetConfigFile(path)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return Config{}, errors.Wrap(err, "read config")
+	}
+
+	var config Config
+	if err := envconf.Apply(v, (&Mod{}).Name(), &config); err != nil {
+		return Config{}, err
+	}
+	if err := v.UnmarshalKey((&Mod{}).Name(), &config); err != nil {
+		return Config{}, errors.Wrap(err, "unmarshal config")
+	}
+	return config, nil
+}
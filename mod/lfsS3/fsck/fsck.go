@@ -0,0 +1,222 @@
+package fsck
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// DefaultQuarantinePrefix 隔离对象默认的键前缀，位于保留前缀下因此不会被计入任何仓库
+const DefaultQuarantinePrefix = storage.ReservedPrefix + "quarantine/"
+
+// emptyOID 空内容的 SHA-256，零字节对象只有在 OID 为该值时才是合法的
+const emptyOID = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusMismatch 内容的 SHA-256 与键中的 OID 不一致
+	StatusMismatch Status = "mismatch"
+	// StatusEmpty 零字节对象
+	StatusEmpty Status = "empty"
+	// StatusTruncated 读取正常结束，但读取到的字节数少于列举时的对象大小
+	StatusTruncated Status = "truncated"
+	// StatusInvalidKey 键不符合布局的格式，不做校验
+	StatusInvalidKey Status = "invalid_key"
+	// StatusError 读取对象失败，包括读取中途的网络错误，此时无法判断内容是否有问题
+	StatusError Status = "error"
+)
+
+// Corrupt 对象内容确定有问题，只有这些对象会被隔离
+func (s Status) Corrupt() bool {
+	return s == StatusMismatch || s == StatusEmpty || s == StatusTruncated
+}
+
+// Finding 一个有问题的对象，以 JSON Lines 格式写入报告
+type Finding struct {
+	Key         string `json:"key"`
+	Status      Status `json:"status"`
+	Size        int64  `json:"size"`
+	Read        int64  `json:"read"`
+	SHA256      string `json:"sha256,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Quarantined string `json:"quarantined,omitempty"`
+}
+
+type Options struct {
+	// Layout 对象键布局，决定遍历的前缀与键的格式
+	Layout storage.Layout
+	// Repo 只检查该仓库，为 nil 时检查当前布局下的全部对象，只支持按仓库存放的布局
+	Repo     *repo.Repo
+	Parallel int
+	// BytesPerSecond 所有并发读取共享的带宽上限，为 0 时不限制
+	BytesPerSecond int64
+	// QuarantinePrefix 不为空时将内容有问题的对象移动到该前缀下
+	QuarantinePrefix string
+	// OnFinding 每发现一个有问题的对象时调用，调用是串行的
+	OnFinding func(Finding)
+}
+
+type Result struct {
+	Objects     int64
+	Bytes       int64
+	Problems    int64
+	Quarantined int64
+}
+
+// Run 读取并重新计算对象的 SHA-256，与键中的 OID 比较
+func Run(ctx context.Context, s *storage.S3Storage, opts Options) (*Result, error) {
+	var limiter *rate.Limiter
+	if opts.BytesPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.BytesPerSecond), int(min(opts.BytesPerSecond, readChunk)))
+	}
+
+	prefix := opts.Layout.Prefix()
+	if opts.Repo != nil {
+		var err error
+		if prefix, err = opts.Layout.RepoPrefix(*opts.Repo); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{}
+	var mu sync.Mutex
+	report := func(f Finding, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Objects++
+		result.Bytes += size
+		if f.Status == StatusOK {
+			return
+		}
+		result.Problems++
+		if f.Quarantined != "" {
+			result.Quarantined++
+		}
+		if opts.OnFinding != nil {
+			opts.OnFinding(f)
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	objects := make(chan storage.ObjectInfo)
+	g.Go(func() error {
+		defer close(objects)
+		return s.WalkObjects(ctx, prefix, func(info storage.ObjectInfo) error {
+			// 按仓库存放时保留前缀下是服务自身的数据
+			if opts.Layout.RepoScoped() && strings.HasPrefix(info.Key, storage.ReservedPrefix) {
+				return nil
+			}
+			// 只检查仓库本身的对象，子命名空间下的仓库不包含在内
+			if opts.Repo != nil && strings.Contains(strings.TrimPrefix(info.Key, prefix), "/") {
+				return nil
+			}
+			select {
+			case objects <- info:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+	for range max(opts.Parallel, 1) {
+		g.Go(func() error {
+			for info := range objects {
+				f := check(ctx, s, opts.Layout, info, limiter)
+				if f.Status.Corrupt() && opts.QuarantinePrefix != "" {
+					f = quarantine(ctx, s, f, opts.QuarantinePrefix)
+				}
+				report(f, info.Size)
+			}
+			return ctx.Err()
+		})
+	}
+	err := g.Wait()
+	return result, err
+}
+
+func check(ctx context.Context, s *storage.S3Storage, layout storage.Layout, info storage.ObjectInfo, limiter *rate.Limiter) Finding {
+	f := Finding{Key: info.Key, Size: info.Size}
+	_, oid, ok := layout.ParseKey(info.Key)
+	if !ok {
+		f.Status = StatusInvalidKey
+		return f
+	}
+
+	body, err := s.GetObject(ctx, info.Key)
+	if err != nil {
+		f.Status, f.Error = StatusError, err.Error()
+		return f
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	var r io.Reader = body
+	if limiter != nil {
+		r = &limitedReader{ctx: ctx, r: body, limiter: limiter}
+	}
+	f.Read, err = io.Copy(h, r)
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	// 读取中途出错时内容不完整，只能报告错误，不能据此判断对象已损坏
+	switch {
+	case err != nil:
+		f.Status, f.Error = StatusError, err.Error()
+	case f.Read < info.Size:
+		f.Status = StatusTruncated
+	case f.Read == 0 && oid != emptyOID:
+		f.Status = StatusEmpty
+	case f.SHA256 != oid:
+		f.Status = StatusMismatch
+	default:
+		f.Status = StatusOK
+	}
+	return f
+}
+
+// quarantine 将对象移动到隔离前缀下，保留原来的键以便恢复
+func quarantine(ctx context.Context, s *storage.S3Storage, f Finding, prefix string) Finding {
+	dst := prefix + f.Key
+	if err := s.CopyObject(ctx, s.BucketName(), f.Key, dst, f.Size); err != nil {
+		f.Error = errors.Wrap(err, "quarantine").Error()
+		return f
+	}
+	if err := s.DeleteObject(ctx, f.Key); err != nil {
+		f.Error = errors.Wrap(err, "quarantine").Error()
+		return f
+	}
+	f.Quarantined = dst
+	return f
+}
+
+const readChunk = 256 << 10
+
+// limitedReader 按共享的令牌桶限制读取速度
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > l.limiter.Burst() {
+		p = p[:l.limiter.Burst()]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if waitErr := l.limiter.WaitN(l.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
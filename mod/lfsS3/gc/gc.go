@@ -0,0 +1,102 @@
+package gc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/auth"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/gitrepo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+)
+
+type Options struct {
+	Repo repo.Repo
+	// Layout 对象键布局，只支持按仓库存放的布局
+	Layout storage.Layout
+	// URL 仓库地址，为空时使用上游代码托管平台上的同名仓库
+	URL string
+	// Dir 本地裸仓库目录，已存在时执行 fetch，为空时克隆到临时目录并在结束后删除
+	Dir      string
+	Username string
+	Password string
+	// GracePeriod 最近修改时间在该时长内的对象不会被删除，避免误删已上传但提交尚未推送的对象
+	GracePeriod time.Duration
+	DryRun      bool
+	// Progress 克隆与拉取进度的输出，为空时不输出
+	Progress io.Writer
+	// OnOrphan 每发现一个可删除的对象时调用，删除前调用
+	OnOrphan func(oid string, info storage.ObjectInfo)
+}
+
+type Result struct {
+	Commits    int
+	Referenced int
+	Objects    int
+	// Orphaned 不再被引用且超过保护期的对象，非 DryRun 时已被删除
+	Orphaned      int
+	OrphanedBytes int64
+	InGracePeriod int
+}
+
+// Run 遍历仓库所有引用可达的提交，收集其中的 LFS 指针，删除存储中不再被引用的对象
+func Run(ctx context.Context, s *storage.S3Storage, opts Options) (*Result, error) {
+	// 按内容寻址的对象在仓库间共享，无法只根据一个仓库的历史判断是否可以删除
+	prefix, err := opts.Layout.RepoPrefix(opts.Repo)
+	if err != nil {
+		return nil, err
+	}
+	url := opts.URL
+	if url == "" {
+		url = auth.ForgeURL + "/" + opts.Repo.String() + ".git"
+	}
+	r, cleanup, err := gitrepo.Open(ctx, gitrepo.Options{
+		URL:      url,
+		Dir:      opts.Dir,
+		Username: opts.Username,
+		Password: opts.Password,
+		Progress: opts.Progress,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	referenced, commits, err := gitrepo.Pointers(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "refusing to collect garbage")
+	}
+	result := &Result{Commits: commits, Referenced: len(referenced)}
+
+	deadline := time.Now().Add(-opts.GracePeriod)
+	err = s.WalkObjects(ctx, prefix, func(info storage.ObjectInfo) error {
+		oid := strings.TrimPrefix(info.Key, prefix)
+		// 子命名空间下其他仓库的对象以及非 LFS 对象不处理
+		if !pointer.ValidOID(oid) {
+			return nil
+		}
+		result.Objects++
+		if _, ok := referenced[oid]; ok {
+			return nil
+		}
+		if info.LastModified.After(deadline) {
+			result.InGracePeriod++
+			return nil
+		}
+
+		result.Orphaned++
+		result.OrphanedBytes += info.Size
+		if opts.OnOrphan != nil {
+			opts.OnOrphan(oid, info)
+		}
+		if opts.DryRun {
+			return nil
+		}
+		return s.DeleteObject(ctx, info.Key)
+	})
+	return result, err
+}
@@ -1,21 +1,37 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/asjdf/lfs-s3/mod/jinx/accesslog"
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
 	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/auth"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/metrics"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/prereceive"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/quota"
 	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
 	"github.com/juanjiTech/jin"
 	"github.com/juanjiTech/jin/render"
+	"github.com/pkg/errors"
 )
 
 const (
 	ContentType = "application/vnd.git-lfs+json"
+	// ServerTimingHeader 批量接口返回各阶段耗时的响应头
+	ServerTimingHeader = "Server-Timing"
+
+	batchPathSuffix       = "/info/lfs/objects/batch"
+	verifyPathSuffix      = "/info/lfs/objects/verify"
+	batchDocumentationURL = "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md"
 )
 
 type LFSObject struct {
@@ -29,7 +45,7 @@ type LFSBatchRequest struct {
 	Transfers []string    `json:"transfers,omitempty"`
 	Ref       *LFSRef     `json:"ref,omitempty"`
 	Objects   []LFSObject `json:"objects"`
-	HashAlgo  string      `json:"hash_algo,omitempty"` // 可选，默认 sha256
+	HashAlgo  string      `json:"hash_algo,omitempty"` // 可选，默认 sha256，目前仅支持 sha256
 }
 
 type LFSRef struct {
@@ -55,6 +71,7 @@ type LFSObjectResponse struct {
 	Actions       struct {
 		Download *LFSObjectAction `json:"download,omitempty"`
 		Upload   *LFSObjectAction `json:"upload,omitempty"`
+		Verify   *LFSObjectAction `json:"verify,omitempty"`
 	} `json:"actions"`
 	Error *LFSObjectError `json:"error,omitempty"`
 }
@@ -62,6 +79,8 @@ type LFSObjectResponse struct {
 type LFSObjectError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// RetryAfter 可重试错误建议的重试间隔（秒），例如对象正在从归档存储中恢复
+	RetryAfter int `json:"retry_after,omitempty"`
 }
 
 type LFSResponseError struct {
@@ -73,94 +92,183 @@ type LFSResponseError struct {
 type Handler struct {
 	storage    *storage.S3Storage
 	authorizer *auth.Authorizer
+	quota      *quota.Tracker
+	rules      atomic.Pointer[Rules]
+}
+
+// Rules 处理请求时使用的限制与键布局，可以在运行时整体替换，每个请求只使用同一份规则
+type Rules struct {
+	Limits *Limits
+	Layout *Layout
+	// ServerTiming 鉴权成功后是否通过 Server-Timing 响应头返回鉴权耗时
+	ServerTiming bool
 }
 
-func NewHandler(s *storage.S3Storage, a *auth.Authorizer) *Handler {
-	return &Handler{
+func NewHandler(s *storage.S3Storage, a *auth.Authorizer, q *quota.Tracker, rules *Rules) *Handler {
+	h := &Handler{
 		storage:    s,
 		authorizer: a,
+		quota:      q,
 	}
+	h.SetRules(rules)
+	return h
+}
+
+// Layout 返回当前使用的键布局
+func (h *Handler) Layout() *Layout {
+	return h.rules.Load().Layout
+}
+
+// SetRules 原子地替换处理规则，正在处理的请求继续使用原来的规则
+func (h *Handler) SetRules(rules *Rules) {
+	h.rules.Store(rules)
 }
 
-func (h *Handler) RegisterRoutes(e *jin.Engine) {
-	e.POST("/:repoOwner/:repoName/info/lfs/objects/batch", h.handleBatch)
-	e.NoRoute(func(c *jin.Context) {
-		fmt.Println(c.Request.URL.Path)
-	})
+// RegisterRoutes 注册LFS接口，仓库路径可以是任意层级的命名空间，因此使用通配路由并在处理时解析
+func (h *Handler) RegisterRoutes(g *jin.RouterGroup) {
+	g.POST("/*repoPath", h.handle)
 }
 
-func (h *Handler) handleBatch(c *jin.Context) {
+func (h *Handler) handle(c *jin.Context) {
+	rules := h.rules.Load()
+	switch repoPath := c.Params.ByName("repoPath"); {
+	case strings.HasSuffix(repoPath, verifyPathSuffix):
+		h.handleVerify(c, rules)
+	case strings.HasSuffix(repoPath, prereceive.PathSuffix):
+		h.handlePreReceive(c, rules)
+	default:
+		h.handleBatch(c, rules)
+	}
+}
+
+func (h *Handler) handleBatch(c *jin.Context, rules *Rules) {
+	start := time.Now()
+	operation := "unknown"
+	defer func() {
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.BatchRequests.WithLabelValues(operation, status).Inc()
+		metrics.BatchDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+	}()
+
 	// 设置响应头
 	c.Writer.Header().Set("Content-Type", ContentType)
 
-	// 鉴权
-	if err := h.authorizer.RequestAuthorizer(c.Request); err != nil {
-		c.Render(http.StatusUnauthorized, render.JSON{Data: LFSResponseError{
-			Message:          "Authentication required",
-			DocumentationURL: "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md",
-		}})
+	// 记录访问日志字段
+	logEntry := h.accessLogEntry(c)
+
+	// 解析仓库路径
+	repoPath, ok := strings.CutSuffix(c.Params.ByName("repoPath"), batchPathSuffix)
+	if !ok {
+		renderError(c, http.StatusNotFound, "Not found")
+		return
+	}
+	r, err := repo.Parse(repoPath)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "Invalid path")
 		return
 	}
 
+	// 鉴权，开启后成功时耗时通过 Server-Timing 响应头返回，便于压测时区分鉴权与批量请求本身的耗时
+	authStart := time.Now()
+	if err := h.authorizer.RequestAuthorizer(c.Request, r); err != nil {
+		renderError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	if rules.ServerTiming {
+		c.Writer.Header().Set(ServerTimingHeader, ServerTiming("auth", time.Since(authStart)))
+	}
+
 	// 读取请求体
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.Render(http.StatusBadRequest, render.JSON{Data: LFSResponseError{
-			Message:          "Failed to read request body",
-			DocumentationURL: "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md",
-		}})
+	limit := rules.Limits.For(r)
+	body, ok := readBody(c, limit.MaxBodyBytes)
+	if !ok {
 		return
 	}
-	defer c.Request.Body.Close()
 
 	var req LFSBatchRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		c.Render(http.StatusBadRequest, render.JSON{Data: LFSResponseError{
-			Message:          "Invalid JSON format",
-			DocumentationURL: "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md",
-		}})
+		renderError(c, http.StatusBadRequest, "Invalid JSON format")
 		return
 	}
 
 	// 验证必需字段
 	if req.Operation == "" {
-		c.Render(http.StatusBadRequest, render.JSON{Data: LFSResponseError{
-			Message:          "operation is required",
-			DocumentationURL: "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md",
-		}})
+		renderError(c, http.StatusBadRequest, "operation is required")
 		return
 	}
 
 	if len(req.Objects) == 0 {
-		c.Render(http.StatusBadRequest, render.JSON{Data: LFSResponseError{
-			Message:          "objects array is required and must not be empty",
-			DocumentationURL: "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md",
-		}})
+		renderError(c, http.StatusBadRequest, "objects array is required and must not be empty")
 		return
 	}
 
-	pathParts := strings.Split(strings.TrimPrefix(c.Request.URL.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		c.Render(http.StatusBadRequest, render.JSON{Data: LFSResponseError{
-			Message:          "Invalid path",
-			DocumentationURL: "https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md",
-		}})
+	if len(req.Objects) > limit.MaxObjects {
+		renderError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many objects in batch: %d, the maximum is %d", len(req.Objects), limit.MaxObjects))
 		return
 	}
-	repoOwner, repoName := pathParts[0], pathParts[1]
+
+	if req.HashAlgo != "" && req.HashAlgo != HashAlgoSHA256 {
+		renderError(c, http.StatusConflict, fmt.Sprintf("Unsupported hash algorithm %q, only %s is supported", req.HashAlgo, HashAlgoSHA256))
+		return
+	}
+
+	if req.Operation == "download" || req.Operation == "upload" {
+		operation = req.Operation
+	}
+	if logEntry != nil {
+		logEntry.Owner, logEntry.Repo = r.Owner, r.Name
+		logEntry.Operation = req.Operation
+		logEntry.Objects = len(req.Objects)
+		for _, obj := range req.Objects {
+			logEntry.Bytes += max(obj.Size, 0)
+		}
+	}
 
 	resp := LFSBatchResponse{
 		Transfer: "basic", // 默认使用 basic 传输适配器
 		Objects:  make([]LFSObjectResponse, len(req.Objects)),
-		HashAlgo: req.HashAlgo,
+		HashAlgo: HashAlgoSHA256,
+	}
+
+	// 校验对象，无效的对象返回 422 错误且不再处理
+	objErrs := make([]*LFSObjectError, len(req.Objects))
+	for i, obj := range req.Objects {
+		objErrs[i] = validateObject(obj)
+	}
+
+	// 开启配额时检查上传是否会超出配额，已存在的对象不需要重复上传
+	var exists []bool
+	var reservation *quota.Reservation
+	if req.Operation == "upload" && h.quota.Enabled() {
+		exists = h.existingObjects(c.Request.Context(), rules.Layout, r, req.Objects, objErrs)
+		reservation = h.quota.Reserve(r)
+		hasNew := false
+		for i := range exists {
+			hasNew = hasNew || (objErrs[i] == nil && !exists[i])
+		}
+		if hasNew {
+			if err := reservation.Full(); err != nil {
+				renderError(c, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+		}
 	}
 
+	retryAfter := 0
 	for i, obj := range req.Objects {
+		metrics.BatchObjects.WithLabelValues(r.Owner, r.Name, operation).Inc()
+		metrics.BatchBytes.WithLabelValues(r.Owner, r.Name, operation).Add(float64(max(obj.Size, 0)))
+
 		respObj := LFSObjectResponse{
 			OID:           obj.OID,
 			Size:          obj.Size,
 			Authenticated: true,
 		}
+		if objErrs[i] != nil {
+			respObj.Error = objErrs[i]
+			resp.Objects[i] = respObj
+			continue
+		}
 
 		// 根据操作类型生成相应的预签名URL
 		expiresIn := 1 * time.Hour
@@ -169,7 +277,13 @@ func (h *Handler) handleBatch(c *jin.Context) {
 
 		switch req.Operation {
 		case "download":
-			url, err = h.storage.GetObjectDownloadURL(c.Request.Context(), GenKey(repoOwner, repoName, obj.OID), expiresIn)
+			store, key := rules.Layout.Locate(c.Request.Context(), h.storage, r, obj.OID)
+			if objErr := checkArchived(c.Request.Context(), store, key); objErr != nil {
+				respObj.Error = objErr
+				retryAfter = max(retryAfter, objErr.RetryAfter)
+				break
+			}
+			url, err = store.GetObjectDownloadURL(c.Request.Context(), key, expiresIn)
 			if err == nil {
 				respObj.Actions.Download = &LFSObjectAction{
 					Href:      url,
@@ -177,12 +291,39 @@ func (h *Handler) handleBatch(c *jin.Context) {
 				}
 			}
 		case "upload":
-			url, err = h.storage.GetObjectUploadURL(c.Request.Context(), GenKey(repoOwner, repoName, obj.OID), expiresIn)
+			if limit.MaxObjectSize > 0 && obj.Size > limit.MaxObjectSize {
+				respObj.Error = &LFSObjectError{
+					Code:    http.StatusUnprocessableEntity,
+					Message: fmt.Sprintf("Object size %d exceeds the maximum of %d bytes", obj.Size, limit.MaxObjectSize),
+				}
+				break
+			}
+			if reservation != nil {
+				if exists[i] {
+					break
+				}
+				if qErr := reservation.Add(obj.OID, obj.Size); qErr != nil {
+					respObj.Error = &LFSObjectError{
+						Code:    http.StatusInsufficientStorage,
+						Message: qErr.Error(),
+					}
+					break
+				}
+			}
+			url, err = h.storage.GetObjectUploadURL(c.Request.Context(), rules.Layout.Key(r, obj.OID), expiresIn)
 			if err == nil {
 				respObj.Actions.Upload = &LFSObjectAction{
 					Href:      url,
+					Header:    h.storage.UploadHeader(),
 					ExpiresIn: int(expiresIn.Seconds()),
 				}
+				// 通过校验接口在上传完成后更新用量
+				if reservation != nil {
+					respObj.Actions.Verify = &LFSObjectAction{
+						Href:      verifyURL(c.Request),
+						ExpiresIn: int(expiresIn.Seconds()),
+					}
+				}
 			}
 		default:
 			err = fmt.Errorf("unsupported operation: %s", req.Operation)
@@ -198,9 +339,158 @@ func (h *Handler) handleBatch(c *jin.Context) {
 		resp.Objects[i] = respObj
 	}
 
+	if retryAfter > 0 {
+		c.Writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
 	c.Render(http.StatusOK, render.JSON{Data: resp})
 }
 
-func GenKey(org, repo, oid string) string {
-	return fmt.Sprintf("%s/%s/%s", org, repo, oid)
+// handleVerify 处理上传完成后的校验请求，确认对象已写入存储且大小一致
+func (h *Handler) handleVerify(c *jin.Context, rules *Rules) {
+	c.Writer.Header().Set("Content-Type", ContentType)
+
+	repoPath := strings.TrimSuffix(c.Params.ByName("repoPath"), verifyPathSuffix)
+	r, err := repo.Parse(repoPath)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "Invalid path")
+		return
+	}
+	if logEntry := h.accessLogEntry(c); logEntry != nil {
+		logEntry.Owner, logEntry.Repo = r.Owner, r.Name
+		logEntry.Operation = "verify"
+		logEntry.Objects = 1
+	}
+
+	if err := h.authorizer.RequestAuthorizer(c.Request, r); err != nil {
+		renderError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	body, ok := readBody(c, rules.Limits.For(r).MaxBodyBytes)
+	if !ok {
+		return
+	}
+
+	var obj LFSObject
+	if err := json.Unmarshal(body, &obj); err != nil {
+		renderError(c, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	if objErr := validateObject(obj); objErr != nil {
+		renderError(c, objErr.Code, objErr.Message)
+		return
+	}
+
+	info, err := h.storage.StatObject(c.Request.Context(), rules.Layout.Key(r, obj.OID))
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		renderError(c, http.StatusNotFound, "Object not found")
+		return
+	}
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if info.Size != obj.Size {
+		renderError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Object size mismatch: expected %d, got %d", obj.Size, info.Size))
+		return
+	}
+
+	if h.quota.Enabled() {
+		h.quota.Add(r, obj.OID, info)
+	}
+	c.Status(http.StatusOK)
+}
+
+// readBody 读取不超过 limit 字节的请求体，失败时已写入错误响应
+func readBody(c *jin.Context, limit int64) ([]byte, bool) {
+	defer c.Request.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			renderError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body too large, the maximum is %d bytes", limit))
+			return nil, false
+		}
+		renderError(c, http.StatusBadRequest, "Failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// accessLogEntry 返回访问日志条目并记录与鉴权一致的请求用户，需要在鉴权之前调用，注意不要记录任何凭据
+func (h *Handler) accessLogEntry(c *jin.Context) *accesslog.Entry {
+	logEntry := accesslog.FromContext(c)
+	if logEntry != nil {
+		logEntry.User = h.authorizer.Identity(c.Request)
+	}
+	return logEntry
+}
+
+// existingObjects 检查批量请求中的有效对象是否已存在于存储中，双读期间已存在于旧布局中的对象同样视为已存在，
+// 检查失败的对象视为不存在
+func (h *Handler) existingObjects(ctx context.Context, layout *Layout, r repo.Repo, objects []LFSObject, objErrs []*LFSObjectError) []bool {
+	exists := make([]bool, len(objects))
+	for i, obj := range objects {
+		if objErrs[i] != nil {
+			continue
+		}
+		ok, err := layout.Exists(ctx, h.storage, r, obj.OID)
+		exists[i] = err == nil && ok
+	}
+	return exists
+}
+
+// verifyURL 根据批量请求的地址生成校验接口的地址
+func verifyURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + req.Host + strings.TrimSuffix(req.URL.Path, batchPathSuffix) + verifyPathSuffix
+}
+
+// renderError 返回批量接口级别的错误，并附带请求ID方便排查
+func renderError(c *jin.Context, code int, message string) {
+	c.Render(code, render.JSON{Data: LFSResponseError{
+		Message:          message,
+		RequestID:        requestid.FromContext(c.Request.Context()),
+		DocumentationURL: batchDocumentationURL,
+	}})
+}
+
+// checkArchived 检查对象是否已被归档，若已归档则发起恢复并返回可重试的对象错误
+func checkArchived(ctx context.Context, s *storage.S3Storage, key string) *LFSObjectError {
+	if !s.ArchiveEnabled() {
+		return nil
+	}
+
+	// HEAD 失败时交由预签名下载地址暴露问题，不影响未启用归档的对象
+	info, err := s.GetArchiveStatus(ctx, key)
+	if err != nil || info.Status == storage.ArchiveStatusAvailable {
+		return nil
+	}
+
+	if info.Status == storage.ArchiveStatusArchived {
+		if err := s.RestoreObject(ctx, key, info.StorageClass); err != nil {
+			return &LFSObjectError{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	retryAfter := int(s.RestoreRetryAfter().Seconds())
+	return &LFSObjectError{
+		Code:       http.StatusServiceUnavailable,
+		Message:    fmt.Sprintf("Object is being restored from archive storage, retry after %d seconds", retryAfter),
+		RetryAfter: retryAfter,
+	}
+}
+
+// ServerTiming 返回 Server-Timing 响应头中的一项，耗时以毫秒为单位
+func ServerTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d.Microseconds())/1000)
 }
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+)
+
+type LayoutConfig struct {
+	// Name 对象键布局：repo（<仓库>/<OID>，默认）或 content（按内容寻址，仓库间共享对象）
+	Name string `yaml:"name"`
+	// Previous 迁移期间的旧布局，配置后下载时若新布局中不存在对象则回退读取旧布局
+	Previous PreviousLayoutConfig `yaml:"previous"`
+}
+
+type PreviousLayoutConfig struct {
+	// Name 旧布局名称，为空时不开启双读
+	Name string `yaml:"name"`
+	// BucketName 旧布局所在的存储桶，为空时与当前存储桶相同
+	BucketName string `yaml:"bucketName"`
+}
+
+// Layout 处理器读写对象时使用的键布局，上传总是写入当前布局
+type Layout struct {
+	current storage.Layout
+
+	previous        storage.Layout
+	previousStorage *storage.S3Storage
+}
+
+// NewLayout 根据配置创建键布局，旧布局位于其他存储桶时使用相同的 S3 配置访问
+func NewLayout(cfg LayoutConfig, s3Config storage.S3Config, s *storage.S3Storage) (*Layout, error) {
+	current, err := storage.ParseLayout(cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	l := &Layout{current: current}
+	if cfg.Previous.Name == "" {
+		return l, nil
+	}
+
+	l.previous, err = storage.ParseLayout(cfg.Previous.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "previous layout")
+	}
+	l.previousStorage = s
+	if cfg.Previous.BucketName != "" && cfg.Previous.BucketName != s3Config.BucketName {
+		s3Config.BucketName = cfg.Previous.BucketName
+		if l.previousStorage, err = storage.NewS3Storage(s3Config); err != nil {
+			return nil, errors.Wrap(err, "previous bucket")
+		}
+	}
+	if l.previous == l.current && l.previousStorage == s {
+		return nil, errors.New("previous layout is the same as the current one")
+	}
+	return l, nil
+}
+
+// Current 返回当前布局
+func (l *Layout) Current() storage.Layout {
+	return l.current
+}
+
+// Key 返回对象在当前布局下的键
+func (l *Layout) Key(r repo.Repo, oid string) string {
+	return l.current.Key(r, oid)
+}
+
+// Location 对象可能所在的存储与键
+type Location struct {
+	Storage *storage.S3Storage
+	Key     string
+}
+
+// Locations 返回对象在当前布局中的位置，双读期间还包括旧布局中的位置
+func (l *Layout) Locations(s *storage.S3Storage, r repo.Repo, oid string) []Location {
+	locations := []Location{{Storage: s, Key: l.current.Key(r, oid)}}
+	if l.previousStorage != nil {
+		locations = append(locations, Location{Storage: l.previousStorage, Key: l.previous.Key(r, oid)})
+	}
+	return locations
+}
+
+// Locate 返回下载对象时应读取的存储与键，双读期间新布局中不存在的对象回退到旧布局
+func (l *Layout) Locate(ctx context.Context, s *storage.S3Storage, r repo.Repo, oid string) (*storage.S3Storage, string) {
+	key := l.current.Key(r, oid)
+	if l.previousStorage == nil {
+		return s, key
+	}
+	// 其他错误交由预签名下载地址暴露问题
+	if _, err := s.StatObject(ctx, key); errors.Is(err, storage.ErrObjectNotFound) {
+		return l.previousStorage, l.previous.Key(r, oid)
+	}
+	return s, key
+}
+
+// Exists 检查对象是否存在于当前布局中，双读期间同时检查旧布局
+func (l *Layout) Exists(ctx context.Context, s *storage.S3Storage, r repo.Repo, oid string) (bool, error) {
+	ok, err := s.ObjectExists(ctx, l.current.Key(r, oid))
+	if err != nil || ok || l.previousStorage == nil {
+		return ok, err
+	}
+	return l.previousStorage.ObjectExists(ctx, l.previous.Key(r, oid))
+}
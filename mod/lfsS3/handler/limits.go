@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxBodyBytes = 10 << 20
+	defaultMaxObjects   = 1000
+	defaultMaxPackBytes = 256 << 20
+)
+
+type LimitsConfig struct {
+	// MaxBodyBytes 请求体的最大字节数，默认 10 MiB
+	MaxBodyBytes int64 `yaml:"maxBodyBytes"`
+	// MaxObjects 单次批量请求的最大对象数，默认 1000
+	MaxObjects int `yaml:"maxObjects"`
+	// MaxObjectSize 允许上传的单个对象的最大字节数，为 0 时不限制
+	MaxObjectSize int64 `yaml:"maxObjectSize"`
+	// MaxPackBytes pre-receive 检查接口接收的 packfile 的最大字节数，默认 256 MiB
+	MaxPackBytes int64 `yaml:"maxPackBytes"`
+	// Repos 为指定仓库覆盖上述限制，为 0 的字段沿用全局配置
+	Repos []RepoLimitsConfig `yaml:"repos"`
+}
+
+type RepoLimitsConfig struct {
+	Repo          string `yaml:"repo"`
+	MaxBodyBytes  int64  `yaml:"maxBodyBytes"`
+	MaxObjects    int    `yaml:"maxObjects"`
+	MaxObjectSize int64  `yaml:"maxObjectSize"`
+	MaxPackBytes  int64  `yaml:"maxPackBytes"`
+}
+
+// Limit 对某个仓库生效的限制
+type Limit struct {
+	MaxBodyBytes  int64
+	MaxObjects    int
+	MaxObjectSize int64
+	MaxPackBytes  int64
+}
+
+type Limits struct {
+	global Limit
+	repos  map[string]Limit
+}
+
+func NewLimits(cfg LimitsConfig) (*Limits, error) {
+	l := &Limits{
+		global: Limit{
+			MaxBodyBytes:  cfg.MaxBodyBytes,
+			MaxObjects:    cfg.MaxObjects,
+			MaxObjectSize: cfg.MaxObjectSize,
+			MaxPackBytes:  cfg.MaxPackBytes,
+		},
+		repos: map[string]Limit{},
+	}
+	if l.global.MaxBodyBytes <= 0 {
+		l.global.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if l.global.MaxObjects <= 0 {
+		l.global.MaxObjects = defaultMaxObjects
+	}
+	if l.global.MaxPackBytes <= 0 {
+		l.global.MaxPackBytes = defaultMaxPackBytes
+	}
+
+	for _, rc := range cfg.Repos {
+		r, err := repo.Parse(rc.Repo)
+		if err != nil {
+			return nil, errors.Errorf("invalid limits repo %q", rc.Repo)
+		}
+		limit := l.global
+		if rc.MaxBodyBytes > 0 {
+			limit.MaxBodyBytes = rc.MaxBodyBytes
+		}
+		if rc.MaxObjects > 0 {
+			limit.MaxObjects = rc.MaxObjects
+		}
+		if rc.MaxObjectSize > 0 {
+			limit.MaxObjectSize = rc.MaxObjectSize
+		}
+		if rc.MaxPackBytes > 0 {
+			limit.MaxPackBytes = rc.MaxPackBytes
+		}
+		l.repos[r.String()] = limit
+	}
+	return l, nil
+}
+
+// For 返回仓库生效的限制
+func (l *Limits) For(r repo.Repo) Limit {
+	if limit, ok := l.repos[r.String()]; ok {
+		return limit
+	}
+	return l.global
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+)
+
+func TestLimitsFor(t *testing.T) {
+	l, err := NewLimits(LimitsConfig{
+		MaxObjects:    10,
+		MaxObjectSize: 100,
+		Repos: []RepoLimitsConfig{
+			{Repo: "group/sub/big", MaxObjectSize: 1000, MaxPackBytes: 1 << 30},
+			{Repo: "owner/small.git", MaxObjects: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global := Limit{
+		MaxBodyBytes:  defaultMaxBodyBytes,
+		MaxObjects:    10,
+		MaxObjectSize: 100,
+		MaxPackBytes:  defaultMaxPackBytes,
+	}
+	tests := []struct {
+		repo repo.Repo
+		want Limit
+	}{
+		{repo: repo.Repo{Owner: "owner", Name: "other"}, want: global},
+		{repo: repo.Repo{Owner: "group", Name: "big"}, want: global},
+		{
+			repo: repo.Repo{Owner: "group/sub", Name: "big"},
+			want: Limit{MaxBodyBytes: defaultMaxBodyBytes, MaxObjects: 10, MaxObjectSize: 1000, MaxPackBytes: 1 << 30},
+		},
+		{
+			repo: repo.Repo{Owner: "owner", Name: "small"},
+			want: Limit{MaxBodyBytes: defaultMaxBodyBytes, MaxObjects: 2, MaxObjectSize: 100, MaxPackBytes: defaultMaxPackBytes},
+		},
+	}
+	for _, tt := range tests {
+		if got := l.For(tt.repo); got != tt.want {
+			t.Errorf("For(%s) = %+v, want %+v", tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestNewLimitsInvalidRepo(t *testing.T) {
+	if _, err := NewLimits(LimitsConfig{Repos: []RepoLimitsConfig{{Repo: "name"}}}); err == nil {
+		t.Error("NewLimits() with an invalid repo succeeded, want error")
+	}
+}
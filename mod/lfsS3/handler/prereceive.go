@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/prereceive"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/juanjiTech/jin"
+	"github.com/juanjiTech/jin/render"
+	"github.com/pkg/errors"
+)
+
+// handlePreReceive 检查一次推送新增的提交中的 LFS 指针引用的对象是否都已上传，
+// 请求体为推送新增对象的 packfile，新旧提交通过 old 与 new 查询参数传入
+func (h *Handler) handlePreReceive(c *jin.Context, rules *Rules) {
+	c.Writer.Header().Set("Content-Type", ContentType)
+	defer c.Request.Body.Close()
+
+	repoPath := strings.TrimSuffix(c.Params.ByName("repoPath"), prereceive.PathSuffix)
+	r, err := repo.Parse(repoPath)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "Invalid path")
+		return
+	}
+	if logEntry := h.accessLogEntry(c); logEntry != nil {
+		logEntry.Owner, logEntry.Repo = r.Owner, r.Name
+		logEntry.Operation = "pre-receive"
+	}
+
+	if err := h.authorizer.RequestAuthorizer(c.Request, r); err != nil {
+		renderError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	query := c.Request.URL.Query()
+	oldRev, newRev := query.Get("old"), query.Get("new")
+	if !plumbing.IsHash(oldRev) || !plumbing.IsHash(newRev) {
+		renderError(c, http.StatusBadRequest, "old and new must be full commit hashes")
+		return
+	}
+
+	limit := rules.Limits.For(r).MaxPackBytes
+	pack := http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	exists := func(ctx context.Context, oid string) (bool, error) {
+		return rules.Layout.Exists(ctx, h.storage, r, oid)
+	}
+	missing, err := prereceive.Check(c.Request.Context(), pack, plumbing.NewHash(oldRev), plumbing.NewHash(newRev), exists)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			renderError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Packfile too large, the maximum is %d bytes", limit))
+			return
+		}
+		var packErr *prereceive.PackError
+		if errors.As(err, &packErr) {
+			renderError(c, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		logx.NameSpace("prereceive").Errorw("failed to check objects", "repo", r.String(), "request_id", requestid.FromContext(c.Request.Context()), "error", err)
+		renderError(c, http.StatusInternalServerError, "Failed to check objects")
+		return
+	}
+	if missing == nil {
+		missing = []prereceive.Missing{}
+	}
+	c.Render(http.StatusOK, render.JSON{Data: prereceive.Response{Missing: missing}})
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+)
+
+// HashAlgoSHA256 唯一支持的对象哈希算法
+const HashAlgoSHA256 = "sha256"
+
+// validateObject 校验批量请求中的单个对象，无效时返回 422 对象错误
+func validateObject(obj LFSObject) *LFSObjectError {
+	if !pointer.ValidOID(obj.OID) {
+		return &LFSObjectError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("Invalid object ID %q, expected a lowercase hex SHA-256", obj.OID),
+		}
+	}
+	if obj.Size < 0 {
+		return &LFSObjectError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("Invalid object size %d", obj.Size),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateObject(t *testing.T) {
+	oid := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name  string
+		obj   LFSObject
+		valid bool
+	}{
+		{name: "valid", obj: LFSObject{OID: oid, Size: 4}, valid: true},
+		{name: "empty object", obj: LFSObject{OID: oid, Size: 0}, valid: true},
+		{name: "negative size", obj: LFSObject{OID: oid, Size: -1}},
+		{name: "empty oid", obj: LFSObject{Size: 4}},
+		{name: "short oid", obj: LFSObject{OID: oid[:63], Size: 4}},
+		{name: "long oid", obj: LFSObject{OID: oid + "0", Size: 4}},
+		{name: "uppercase oid", obj: LFSObject{OID: strings.ToUpper(oid), Size: 4}},
+		{name: "non hex oid", obj: LFSObject{OID: "g" + oid[1:], Size: 4}},
+		{name: "path traversal", obj: LFSObject{OID: "../" + oid[3:], Size: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateObject(tt.obj)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("validateObject() = %+v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Code != http.StatusUnprocessableEntity {
+				t.Errorf("validateObject() = %+v, want a 422 error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package locks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrLockExists   = errors.New("lock already exists")
+	ErrLockNotFound = errors.New("lock not found")
+)
+
+const keyPrefix = storage.ReservedPrefix + "locks/"
+
+type Owner struct {
+	Name string `json:"name"`
+}
+
+// Lock 与 LFS 文件锁 API 的锁结构一致
+type Lock struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	LockedAt time.Time `json:"locked_at"`
+	Owner    *Owner    `json:"owner,omitempty"`
+}
+
+// Store 将锁以 JSON 对象的形式保存在存储桶的保留前缀下，
+// 锁ID由仓库内的文件路径决定，因此同一路径只能存在一把锁。
+// 创建锁依赖存储的条件写入，不支持 If-None-Match 的存储上同时创建同一路径的锁可能都会成功，后写入的锁覆盖先写入的锁
+type Store struct {
+	storage *storage.S3Storage
+}
+
+func NewStore(s *storage.S3Storage) *Store {
+	return &Store{storage: s}
+}
+
+func lockID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:])
+}
+
+func repoPrefix(r repo.Repo) string {
+	return keyPrefix + r.String() + "/"
+}
+
+func (s *Store) List(ctx context.Context, r repo.Repo) ([]Lock, error) {
+	var locks []Lock
+	err := s.storage.WalkObjects(ctx, repoPrefix(r), func(obj storage.ObjectInfo) error {
+		// 更深层级的键属于子命名空间下的其他仓库
+		if strings.Contains(strings.TrimPrefix(obj.Key, repoPrefix(r)), "/") {
+			return nil
+		}
+		lock, err := s.get(ctx, obj.Key)
+		if errors.Is(err, ErrLockNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		locks = append(locks, lock)
+		return nil
+	})
+	return locks, err
+}
+
+func (s *Store) Get(ctx context.Context, r repo.Repo, id string) (Lock, error) {
+	return s.get(ctx, repoPrefix(r)+id)
+}
+
+func (s *Store) get(ctx context.Context, key string) (Lock, error) {
+	body, err := s.storage.GetObject(ctx, key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return Lock{}, ErrLockNotFound
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return Lock{}, errors.Wrap(err, "read lock")
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return Lock{}, errors.Wrap(err, "decode lock")
+	}
+	return lock, nil
+}
+
+func (s *Store) Create(ctx context.Context, r repo.Repo, path, owner string) (Lock, error) {
+	lock := Lock{
+		ID:       lockID(path),
+		Path:     path,
+		LockedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if owner != "" {
+		lock.Owner = &Owner{Name: owner}
+	}
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return Lock{}, err
+	}
+
+	err = s.storage.PutObject(ctx, repoPrefix(r)+lock.ID, data, true)
+	if errors.Is(err, storage.ErrObjectExists) {
+		return Lock{}, ErrLockExists
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	return lock, nil
+}
+
+// Delete 删除锁，owner 不为空时只允许删除该用户持有的锁，force 为 true 时忽略持有者
+func (s *Store) Delete(ctx context.Context, r repo.Repo, id, owner string, force bool) (Lock, error) {
+	lock, err := s.Get(ctx, r, id)
+	if err != nil {
+		return Lock{}, err
+	}
+	if !force && owner != "" && (lock.Owner == nil || lock.Owner.Name != owner) {
+		return Lock{}, errors.Errorf("lock %s is owned by another user", id)
+	}
+	if err := s.storage.DeleteObject(ctx, repoPrefix(r)+id); err != nil {
+		return Lock{}, err
+	}
+	return lock, nil
+}
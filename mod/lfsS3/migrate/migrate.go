@@ -0,0 +1,295 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/gitrepo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/oklog/ulid/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultBatchSize = 100
+	// stagingPrefix 迁移时校验前的临时键前缀
+	stagingPrefix = storage.ReservedPrefix + "migrate/"
+)
+
+type Options struct {
+	Repo repo.Repo
+	// Layout 服务使用的键布局，对象写入当前布局，双读期间已存在于旧布局中的对象同样会被跳过
+	Layout *handler.Layout
+	// Endpoint 源 LFS 服务地址，例如 https://git.example.com/owner/repo.git/info/lfs
+	Endpoint string
+	// GitURL 用于收集指针的仓库地址，为空时由 Endpoint 去掉 /info/lfs 得到
+	GitURL string
+	// Dir 本地裸仓库目录，为空时克隆到临时目录
+	Dir string
+	// Username 与 Password 同时用于源 LFS 服务与克隆仓库
+	Username  string
+	Password  string
+	Parallel  int
+	BatchSize int
+	// Progress 克隆与拉取进度的输出，为空时不输出
+	Progress io.Writer
+	// OnProgress 每处理完一个对象时调用，调用是串行的
+	OnProgress func(Result)
+	// OnError 对象迁移失败时调用，调用是串行的
+	OnError func(oid string, err error)
+}
+
+type Result struct {
+	Commits  int
+	Objects  int
+	Bytes    int64
+	Skipped  int
+	Migrated int
+	// MigratedBytes 本次迁移写入的字节数
+	MigratedBytes int64
+	Failed        int
+}
+
+// Done 已处理（跳过、迁移或失败）的对象数
+func (r Result) Done() int {
+	return r.Skipped + r.Migrated + r.Failed
+}
+
+type migrator struct {
+	opts    Options
+	storage *storage.S3Storage
+	client  *http.Client
+
+	mu     sync.Mutex
+	result Result
+}
+
+// Run 收集仓库历史中的 LFS 指针，从源 LFS 服务下载存储中尚不存在的对象并写入存储。
+// 已存在且大小一致的对象会被跳过，因此中断后重新执行即可继续迁移
+func Run(ctx context.Context, s *storage.S3Storage, opts Options) (*Result, error) {
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	if opts.GitURL == "" {
+		opts.GitURL = strings.TrimSuffix(opts.Endpoint, "/info/lfs")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	opts.Parallel = max(opts.Parallel, 1)
+
+	r, cleanup, err := gitrepo.Open(ctx, gitrepo.Options{
+		URL:      opts.GitURL,
+		Dir:      opts.Dir,
+		Username: opts.Username,
+		Password: opts.Password,
+		Progress: opts.Progress,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	pointers, commits, err := gitrepo.Pointers(r)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]pointer.Pointer, 0, len(pointers))
+	m := &migrator{opts: opts, storage: s, client: &http.Client{}}
+	m.result.Commits = commits
+	for _, p := range pointers {
+		list = append(list, p)
+		m.result.Objects++
+		m.result.Bytes += p.Size
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].OID < list[j].OID })
+
+	for start := 0; start < len(list); start += opts.BatchSize {
+		if err := m.migrateBatch(ctx, list[start:min(start+opts.BatchSize, len(list))]); err != nil {
+			return &m.result, err
+		}
+	}
+	return &m.result, nil
+}
+
+func (m *migrator) done(fn func(r *Result)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(&m.result)
+	if m.opts.OnProgress != nil {
+		m.opts.OnProgress(m.result)
+	}
+}
+
+func (m *migrator) fail(oid string, err error) {
+	m.done(func(r *Result) {
+		r.Failed++
+		if m.opts.OnError != nil {
+			m.opts.OnError(oid, err)
+		}
+	})
+}
+
+func (m *migrator) migrateBatch(ctx context.Context, batch []pointer.Pointer) error {
+	// 跳过已迁移的对象
+	missing := make([]bool, len(batch))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(m.opts.Parallel)
+	for i, p := range batch {
+		g.Go(func() error {
+			store, key := m.opts.Layout.Locate(gctx, m.storage, m.opts.Repo, p.OID)
+			info, err := store.StatObject(gctx, key)
+			missing[i] = err != nil || info.Size != p.Size
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var objects []handler.LFSObject
+	for i, p := range batch {
+		if missing[i] {
+			objects = append(objects, handler.LFSObject{OID: p.OID, Size: p.Size})
+		} else {
+			m.done(func(r *Result) { r.Skipped++ })
+		}
+	}
+	if len(objects) == 0 {
+		return ctx.Err()
+	}
+
+	resp, err := m.batch(ctx, objects)
+	if err != nil {
+		return err
+	}
+
+	g, gctx = errgroup.WithContext(ctx)
+	g.SetLimit(m.opts.Parallel)
+	for _, obj := range resp.Objects {
+		g.Go(func() error {
+			if err := m.transfer(gctx, obj); err != nil {
+				m.fail(obj.OID, err)
+				return nil
+			}
+			m.done(func(r *Result) {
+				r.Migrated++
+				r.MigratedBytes += obj.Size
+			})
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return ctx.Err()
+}
+
+// batch 向源 LFS 服务请求下载地址
+func (m *migrator) batch(ctx context.Context, objects []handler.LFSObject) (*handler.LFSBatchResponse, error) {
+	body, err := json.Marshal(handler.LFSBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   objects,
+		HashAlgo:  handler.HashAlgoSHA256,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.opts.Endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", handler.ContentType)
+	req.Header.Set("Content-Type", handler.ContentType)
+	if m.opts.Username != "" || m.opts.Password != "" {
+		req.SetBasicAuth(m.opts.Username, m.opts.Password)
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "source batch request")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var lfsErr handler.LFSResponseError
+		_ = json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&lfsErr)
+		return nil, errors.Errorf("source batch request: %s %s", res.Status, lfsErr.Message)
+	}
+
+	var resp handler.LFSBatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "decode source batch response")
+	}
+	return &resp, nil
+}
+
+// transfer 下载对象并以流的方式写入保留前缀下的临时键，校验大小与 SHA-256 通过后再复制到目标键，
+// 避免不完整或损坏的内容被下载；临时键包含随机部分，并发迁移相同对象时互不影响
+func (m *migrator) transfer(ctx context.Context, obj handler.LFSObjectResponse) error {
+	if obj.Error != nil {
+		return errors.Errorf("source: %d %s", obj.Error.Code, obj.Error.Message)
+	}
+	if !pointer.ValidOID(obj.OID) {
+		return errors.New("source returned an invalid object id")
+	}
+	action := obj.Actions.Download
+	if action == nil {
+		return errors.New("source returned no download action")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+	// 下载地址与源服务同源且未携带凭据时使用源服务的凭据
+	if req.Header.Get("Authorization") == "" && sameHost(action.Href, m.opts.Endpoint) && (m.opts.Username != "" || m.opts.Password != "") {
+		req.SetBasicAuth(m.opts.Username, m.opts.Password)
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "download")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("download: %s", res.Status)
+	}
+
+	staging := stagingPrefix + ulid.Make().String() + "/" + obj.OID
+	defer func() { _ = m.storage.DeleteObject(context.WithoutCancel(ctx), staging) }()
+	h := sha256.New()
+	counter := &countingWriter{}
+	if err := m.storage.UploadObject(ctx, staging, io.TeeReader(res.Body, io.MultiWriter(h, counter))); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); counter.n != obj.Size || sum != obj.OID {
+		return fmt.Errorf("content mismatch: got %d bytes with sha256 %s", counter.n, sum)
+	}
+	return m.storage.CopyObject(ctx, m.storage.BucketName(), staging, m.opts.Layout.Key(m.opts.Repo, obj.OID), obj.Size)
+}
+
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Host == ub.Host
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
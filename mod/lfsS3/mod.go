@@ -1,16 +1,32 @@
 package lfsS3
 
 import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/asjdf/lfs-s3/mod/jinx/healthcheck"
+	jinxMetrics "github.com/asjdf/lfs-s3/mod/jinx/metrics"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/admin"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/admin/adminpb"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/checker"
 	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/locks"
 	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/auth"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/metrics"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/quota"
 	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
 	"github.com/juanjiTech/jframe/core/kernel"
+	"github.com/juanjiTech/jframe/core/logx"
 	"github.com/juanjiTech/jin"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc"
 )
 
 var _ kernel.Module = (*Mod)(nil)
 
+const adminBasePath = "/admin/api"
+
 type S3Config struct {
 	Endpoint        string `yaml:"endpoint"`
 	AccessKeyID     string `yaml:"accessKeyID"`
@@ -19,17 +35,30 @@ type S3Config struct {
 	Region          string `yaml:"region"`
 }
 
-type AuthConfig struct {
-	EnableCache bool `yaml:"enableCache"`
+type Config struct {
+	// BasePath LFS接口的挂载前缀，例如 /lfs，为空时挂载在根路径
+	BasePath string `yaml:"basePath"`
+	// ServerTiming 鉴权成功后通过 Server-Timing 响应头返回鉴权耗时，供压测使用，默认关闭
+	ServerTiming bool                 `yaml:"serverTiming"`
+	S3           storage.S3Config     `yaml:"s3"`
+	Auth         auth.Config          `yaml:"auth"`
+	Admin        AdminConfig          `yaml:"admin"`
+	Quota        quota.Config         `yaml:"quota"`
+	Limits       handler.LimitsConfig `yaml:"limits"`
+	Layout       handler.LayoutConfig `yaml:"layout"`
 }
 
-type Config struct {
-	S3   storage.S3Config `yaml:"s3"`
-	Auth AuthConfig       `yaml:"auth"`
+type AdminConfig struct {
+	// Token 管理接口的访问令牌，为空时不开启管理接口
+	Token string `yaml:"token"`
 }
 
 type Mod struct {
-	config Config
+	config     Config
+	storage    *storage.S3Storage
+	authorizer *auth.Authorizer
+	quota      *quota.Tracker
+	handler    *handler.Handler
 	kernel.UnimplementedModule
 }
 
@@ -52,18 +81,119 @@ func (m *Mod) Load(hub *kernel.Hub) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize S3 storage")
 	}
+	m.storage = s3Storage
 
 	// 初始化鉴权器
-	authorizer := auth.NewAuthorizer(m.config.Auth.EnableCache)
-	defer authorizer.Close()
+	authorizer := auth.NewAuthorizer(m.config.Auth)
+	m.authorizer = authorizer
+
+	// 初始化配额
+	tracker, err := quota.NewTracker(m.config.Quota, s3Storage)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize quota")
+	}
+	m.quota = tracker
+
+	// 初始化请求限制
+	limits, err := handler.NewLimits(m.config.Limits)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize limits")
+	}
+
+	// 初始化对象键布局
+	layout, err := handler.NewLayout(m.config.Layout, m.config.S3, s3Storage)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize layout")
+	}
+	if err := checkQuotaLayout(m.config.Quota, layout.Current()); err != nil {
+		return errors.Wrap(err, "failed to initialize layout")
+	}
+
+	// 注册监控指标
+	jinxMetrics.MustRegister(metrics.Collectors()...)
+	jinxMetrics.MustRegister(authorizer)
+
+	// 注册就绪检查
+	if err := healthcheck.RegisterHealthChecker(
+		checker.NewBucket(s3Storage),
+		checker.NewPresign(s3Storage),
+		checker.NewForge(auth.ForgeURL),
+	); err != nil {
+		return errors.Wrap(err, "failed to register health checkers")
+	}
 
 	// 创建并注册LFS处理器
-	lfsHandler := handler.NewHandler(s3Storage, authorizer)
-	lfsHandler.RegisterRoutes(jinE)
+	m.handler = handler.NewHandler(s3Storage, authorizer, tracker, &handler.Rules{Limits: limits, Layout: layout, ServerTiming: m.config.ServerTiming})
+	m.handler.RegisterRoutes(jinE.Group(m.config.BasePath))
+
+	// 注册管理接口，未配置管理令牌时不开启
+	if m.config.Admin.Token == "" {
+		hub.Log.Info("admin token is not configured, admin API is disabled")
+		return nil
+	}
+	adminService := admin.NewService(s3Storage, authorizer, locks.NewStore(s3Storage), m.handler.Layout)
+	admin.NewHTTPServer(adminService, m.config.Admin.Token).RegisterRoutes(jinE.Group(adminBasePath))
+	// gRPC管理接口需要同时开启grpcx模块
+	var grpcSrv *grpc.Server
+	if hub.Load(&grpcSrv) == nil {
+		adminpb.RegisterAdminServiceServer(grpcSrv, admin.NewGRPCServer(adminService, m.config.Admin.Token))
+	}
 
 	return nil
 }
 
+// Reload 替换存储客户端、鉴权配置、请求限制与键布局，任一部分失败时保留原来的配置；
+// 挂载前缀、管理接口与配额在启动时确定，修改后需要重启才能生效
+func (m *Mod) Reload(config any) error {
+	cfg := *config.(*Config)
+
+	log := logx.NameSpace("module." + m.Name())
+	if cfg.BasePath != m.config.BasePath {
+		log.Warnw("config change requires restart", "key", "basePath")
+		cfg.BasePath = m.config.BasePath
+	}
+	if !reflect.DeepEqual(cfg.Admin, m.config.Admin) {
+		log.Warnw("config change requires restart", "key", "admin")
+		cfg.Admin = m.config.Admin
+	}
+	if !reflect.DeepEqual(cfg.Quota, m.config.Quota) {
+		log.Warnw("config change requires restart", "key", "quota")
+		cfg.Quota = m.config.Quota
+	}
+
+	limits, err := handler.NewLimits(cfg.Limits)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize limits")
+	}
+	layout, err := handler.NewLayout(cfg.Layout, cfg.S3, m.storage)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize layout")
+	}
+	if err := checkQuotaLayout(cfg.Quota, layout.Current()); err != nil {
+		return errors.Wrap(err, "failed to initialize layout")
+	}
+	if err := m.storage.Reload(cfg.S3); err != nil {
+		return errors.Wrap(err, "failed to reload S3 storage")
+	}
+	m.authorizer.Reload(cfg.Auth)
+	m.handler.SetRules(&handler.Rules{Limits: limits, Layout: layout, ServerTiming: cfg.ServerTiming})
+
+	m.config = cfg
+	return nil
+}
+
 func (m *Mod) Start(hub *kernel.Hub) error {
+	m.quota.Start()
+	return nil
+}
+
+func (m *Mod) Stop(wg *sync.WaitGroup, _ context.Context) error {
+	defer wg.Done()
+	if m.quota != nil {
+		m.quota.Stop()
+	}
+	if m.authorizer != nil {
+		m.authorizer.Close()
+	}
 	return nil
 }
@@ -1,19 +1,40 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/asjdf/lfs-s3/mod/jinx/tlsx"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/metrics"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
 	"github.com/jellydator/ttlcache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
 )
 
+var _ prometheus.Collector = (*Authorizer)(nil)
+
+// ForgeURL 上游代码托管平台地址，仓库权限通过该平台校验
+const ForgeURL = "https://github.com"
+
+type Config struct {
+	EnableCache bool `yaml:"enableCache"`
+	// TrustedClients 客户端证书身份（证书主题 CN）白名单，持有这些证书的客户端无需向上游平台鉴权即可访问所有仓库
+	TrustedClients []string `yaml:"trustedClients"`
+}
+
+// Authorizer 的配置可以在运行时通过 Reload 替换
 type Authorizer struct {
-	cache *ttlcache.Cache
+	cache          atomic.Pointer[ttlcache.Cache]
+	trustedClients atomic.Pointer[map[string]struct{}]
 }
 
 type CacheMetrics struct {
@@ -24,40 +45,76 @@ type CacheMetrics struct {
 	Removes int64
 }
 
-func NewAuthorizer(enableCache bool) *Authorizer {
-	if !enableCache {
-		return &Authorizer{cache: nil}
-	}
+func NewAuthorizer(cfg Config) *Authorizer {
+	a := &Authorizer{}
+	a.Reload(cfg)
+	return a
+}
+
+// Reload 替换白名单并按需开启或关闭缓存，缓存保持开启时保留已缓存的鉴权结果
+func (a *Authorizer) Reload(cfg Config) {
+	trustedClients := lo.SliceToMap(cfg.TrustedClients, func(id string) (string, struct{}) {
+		return id, struct{}{}
+	})
+	a.trustedClients.Store(&trustedClients)
 
+	if !cfg.EnableCache {
+		if cache := a.cache.Swap(nil); cache != nil {
+			cache.Close()
+		}
+		return
+	}
+	if a.cache.Load() != nil {
+		return
+	}
 	cache := ttlcache.NewCache()
 	_ = cache.SetTTL(15 * time.Minute)
 	cache.SkipTTLExtensionOnHit(true)
 	cache.SetCacheSizeLimit(1000 * 1000)
-	return &Authorizer{cache: cache}
+	a.cache.Store(cache)
 }
 
 func (a *Authorizer) Close() {
-	if a.cache != nil {
-		a.cache.Close()
+	if cache := a.cache.Swap(nil); cache != nil {
+		cache.Close()
 	}
 }
 
-func (a *Authorizer) RequestAuthorizer(req *http.Request) error {
+// Identity 返回请求用于鉴权的身份：白名单中的客户端证书为 cert:<证书身份>，否则为 Basic 认证的用户名，
+// 需要在 RequestAuthorizer 删除认证头之前调用
+func (a *Authorizer) Identity(req *http.Request) string {
+	if id, ok := a.trustedClient(req); ok {
+		return "cert:" + id
+	}
+	username, _, _ := req.BasicAuth()
+	return username
+}
+
+// trustedClient 返回通过双向 TLS 校验且在白名单中的客户端证书身份
+func (a *Authorizer) trustedClient(req *http.Request) (string, bool) {
+	id := tlsx.ClientIdentity(req)
+	if id == "" {
+		return "", false
+	}
+	_, ok := (*a.trustedClients.Load())[id]
+	return id, ok
+}
+
+func (a *Authorizer) RequestAuthorizer(req *http.Request, r repo.Repo) error {
+	// 通过双向 TLS 校验且在白名单中的客户端直接放行
+	if _, ok := a.trustedClient(req); ok {
+		req.Header.Del("Authorization")
+		return nil
+	}
+
 	username, token, ok := req.BasicAuth()
 	if !ok {
 		return errors.New("request not authenticated")
 	}
 
-	// 从请求路径中获取仓库信息
-	pathParts := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		return errors.New("malformed request")
-	}
-
-	repoOwner, repoName := pathParts[0], pathParts[1]
-	repoURL := fmt.Sprintf("https://github.com/%s/%s", repoOwner, repoName)
+	repoURL := fmt.Sprintf("%s/%s", ForgeURL, r)
 
-	authorized, err := a.isAuthorized(username, token, repoURL)
+	authorized, err := a.isAuthorized(req.Context(), username, token, repoURL)
 	if !authorized {
 		if err != nil {
 			return fmt.Errorf("authentication error: %v", err)
@@ -71,66 +128,106 @@ func (a *Authorizer) RequestAuthorizer(req *http.Request) error {
 	return nil
 }
 
-func (a *Authorizer) isAuthorized(username, token string, repoURL string) (bool, error) {
-	if a.cache == nil {
-		authorized, _, err := isTokenValid(username, token, repoURL)
+func (a *Authorizer) isAuthorized(ctx context.Context, username, token string, repoURL string) (bool, error) {
+	cache := a.cache.Load()
+	if cache == nil {
+		authorized, _, err := isTokenValid(ctx, username, token, repoURL)
 		return authorized, err
 	}
 
 	cacheKey := fmt.Sprintf("%s:%s@%s", username, token, repoURL)
-	if authorized, err := a.cache.Get(cacheKey); err == nil {
+	if authorized, err := cache.Get(cacheKey); err == nil {
 		return authorized.(bool), nil
 	}
 
-	authorized, shouldCache, err := isTokenValid(username, token, repoURL)
+	authorized, shouldCache, err := isTokenValid(ctx, username, token, repoURL)
 	if shouldCache {
-		_ = a.cache.Set(cacheKey, authorized)
+		_ = cache.Set(cacheKey, authorized)
 	}
 
 	return authorized, err
 }
 
-func isTokenValid(username, token string, repoURL string) (authorized bool, shouldCache bool, err error) {
+func isTokenValid(ctx context.Context, username, token string, repoURL string) (authorized bool, shouldCache bool, err error) {
+	start := time.Now()
+	result := "error"
+	defer func() {
+		metrics.ForgeDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+		if result != "authorized" {
+			metrics.ForgeFailures.WithLabelValues(result).Inc()
+		}
+	}()
+
 	infoRefsURL := fmt.Sprintf("%s/info/refs?service=git-upload-pack", repoURL)
 
-	req, err := http.NewRequest(http.MethodGet, infoRefsURL, nil)
+	// 只缓存代码托管平台明确给出的结果，请求未完成（客户端断开、超时、网络错误）时不缓存
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, infoRefsURL, nil)
 	if err != nil {
-		return false, true, err
+		return false, false, err
 	}
 
 	req.Header.Add("Git-Protocol", "version=2")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
 	req.SetBasicAuth(username, token)
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return false, true, err
+		return false, false, err
 	}
 	defer res.Body.Close()
 
 	resBytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return false, true, err
+		return false, false, err
 	}
 
 	if res.StatusCode != http.StatusOK {
 		err = errors.New(string(resBytes))
 
-		// 对于服务器错误，不缓存结果以便下次重试
-		if res.StatusCode >= 500 && res.StatusCode < 600 && res.StatusCode != 501 {
+		// 对于服务器错误、限流与请求超时，不缓存结果以便下次重试
+		if (res.StatusCode >= 500 && res.StatusCode < 600 && res.StatusCode != 501) ||
+			res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestTimeout {
+			result = "upstream_error"
 			return false, false, err
 		}
 
+		result = "denied"
 		return false, true, err
 	}
 
+	result = "authorized"
 	return true, true, nil
 }
 
+// InvalidateCache 清除鉴权缓存，r 为 nil 时清除全部缓存，否则只清除该仓库的缓存，返回清除的条目数
+func (a *Authorizer) InvalidateCache(r *repo.Repo) int {
+	cache := a.cache.Load()
+	if cache == nil {
+		return 0
+	}
+	if r == nil {
+		n := cache.Count()
+		_ = cache.Purge()
+		return n
+	}
+
+	suffix := fmt.Sprintf("@%s/%s", ForgeURL, r)
+	n := 0
+	for _, key := range cache.GetKeys() {
+		if strings.HasSuffix(key, suffix) && cache.Remove(key) == nil {
+			n++
+		}
+	}
+	return n
+}
+
 func (a *Authorizer) CacheMetrics() CacheMetrics {
 	var metrics CacheMetrics
-	if a.cache != nil {
-		internalMetrics := a.cache.GetMetrics()
-		metrics.Keys = int64(a.cache.Count())
+	if cache := a.cache.Load(); cache != nil {
+		internalMetrics := cache.GetMetrics()
+		metrics.Keys = int64(cache.Count())
 		metrics.Hits = internalMetrics.Retrievals
 		metrics.Misses = internalMetrics.Misses
 		metrics.Inserts = internalMetrics.Inserted
@@ -145,3 +242,28 @@ func (a *Authorizer) CacheMetricsHandler(w http.ResponseWriter, req *http.Reques
 		_, _ = w.Write(b)
 	}
 }
+
+var (
+	cacheKeysDesc    = prometheus.NewDesc("lfs_auth_cache_keys", "Number of entries in the authorization cache.", nil, nil)
+	cacheHitsDesc    = prometheus.NewDesc("lfs_auth_cache_hits_total", "Number of authorization cache hits.", nil, nil)
+	cacheMissesDesc  = prometheus.NewDesc("lfs_auth_cache_misses_total", "Number of authorization cache misses.", nil, nil)
+	cacheInsertsDesc = prometheus.NewDesc("lfs_auth_cache_inserts_total", "Number of entries inserted into the authorization cache.", nil, nil)
+	cacheRemovesDesc = prometheus.NewDesc("lfs_auth_cache_removes_total", "Number of entries evicted from the authorization cache.", nil, nil)
+)
+
+func (a *Authorizer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheKeysDesc
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheInsertsDesc
+	ch <- cacheRemovesDesc
+}
+
+func (a *Authorizer) Collect(ch chan<- prometheus.Metric) {
+	m := a.CacheMetrics()
+	ch <- prometheus.MustNewConstMetric(cacheKeysDesc, prometheus.GaugeValue, float64(m.Keys))
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(m.Hits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(m.Misses))
+	ch <- prometheus.MustNewConstMetric(cacheInsertsDesc, prometheus.CounterValue, float64(m.Inserts))
+	ch <- prometheus.MustNewConstMetric(cacheRemovesDesc, prometheus.CounterValue, float64(m.Removes))
+}
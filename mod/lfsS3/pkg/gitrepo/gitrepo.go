@@ -0,0 +1,153 @@
+package gitrepo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/pkg/errors"
+)
+
+type Options struct {
+	URL string
+	// Dir 本地裸仓库目录，已存在时执行 fetch，为空时克隆到临时目录并在关闭时删除
+	Dir      string
+	Username string
+	Password string
+	// Progress 克隆与拉取进度的输出，为空时不输出
+	Progress io.Writer
+}
+
+func (o Options) auth() transport.AuthMethod {
+	if o.Username == "" && o.Password == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: o.Username, Password: o.Password}
+}
+
+// Open 以镜像方式克隆仓库或拉取已有的本地裸仓库，返回的 cleanup 用于删除临时目录
+func Open(ctx context.Context, opts Options) (*git.Repository, func(), error) {
+	dir := opts.Dir
+	cleanup := func() {}
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "lfs-s3-")
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create temporary directory")
+		}
+		dir = tmp
+		cleanup = func() { _ = os.RemoveAll(tmp) }
+	}
+
+	r, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		r, err = git.PlainCloneContext(ctx, dir, true, &git.CloneOptions{
+			URL:      opts.URL,
+			Auth:     opts.auth(),
+			Mirror:   true,
+			Progress: opts.Progress,
+		})
+		if err != nil {
+			cleanup()
+			return nil, nil, errors.Wrapf(err, "clone %s", opts.URL)
+		}
+		return r, cleanup, nil
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, errors.Wrapf(err, "open %s", dir)
+	}
+
+	err = r.FetchContext(ctx, &git.FetchOptions{
+		Auth:     opts.auth(),
+		Force:    true,
+		Prune:    true,
+		Progress: opts.Progress,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		cleanup()
+		return nil, nil, errors.Wrapf(err, "fetch %s", dir)
+	}
+	return r, cleanup, nil
+}
+
+// Pointers 收集所有引用可达的提交中的 LFS 指针，返回以 OID 为键的指针与遍历的提交数
+func Pointers(r *git.Repository) (map[string]pointer.Pointer, int, error) {
+	refs, err := r.References()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "list references")
+	}
+
+	var heads []*object.Commit
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		c, err := PeelCommit(r, ref.Hash())
+		if err != nil {
+			return errors.Wrapf(err, "resolve %s", ref.Name())
+		}
+		if c != nil {
+			heads = append(heads, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(heads) == 0 {
+		return nil, 0, errors.New("repository has no commits")
+	}
+
+	pointers := map[string]pointer.Pointer{}
+	scanner := pointer.NewScanner()
+	seen := map[plumbing.Hash]struct{}{}
+	queue := heads
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, ok := seen[c.Hash]; ok {
+			continue
+		}
+		seen[c.Hash] = struct{}{}
+
+		err := scanner.ScanCommit(c, func(_ string, p pointer.Pointer) error {
+			pointers[p.OID] = p
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		err = c.Parents().ForEach(func(parent *object.Commit) error {
+			queue = append(queue, parent)
+			return nil
+		})
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "read parents of %s", c.Hash)
+		}
+	}
+	return pointers, len(seen), nil
+}
+
+// PeelCommit 解析对象指向的提交，附注标签会被解析到其指向的对象，不指向提交时返回 nil
+func PeelCommit(r *git.Repository, h plumbing.Hash) (*object.Commit, error) {
+	for {
+		obj, err := r.Object(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+		switch o := obj.(type) {
+		case *object.Commit:
+			return o, nil
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "lfs"
+
+var (
+	BatchRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "batch",
+		Name:      "requests_total",
+		Help:      "Number of batch API requests by operation and response status.",
+	}, []string{"operation", "status"})
+
+	BatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "batch",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of batch API requests by operation and response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	BatchObjects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "batch",
+		Name:      "objects_total",
+		Help:      "Number of objects requested through the batch API per repository.",
+	}, []string{"owner", "repo", "operation"})
+
+	BatchBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "batch",
+		Name:      "object_bytes_total",
+		Help:      "Total size of objects requested through the batch API per repository.",
+	}, []string{"owner", "repo", "operation"})
+
+	ForgeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "forge",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of authorization requests sent to the upstream forge.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	ForgeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "forge",
+		Name:      "request_failures_total",
+		Help:      "Number of authorization requests to the upstream forge that failed or were denied.",
+	}, []string{"reason"})
+
+	S3Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "s3",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of S3 API calls by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	S3Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "s3",
+		Name:      "operation_errors_total",
+		Help:      "Number of failed S3 API calls by operation.",
+	}, []string{"operation"})
+)
+
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		BatchRequests,
+		BatchDuration,
+		BatchObjects,
+		BatchBytes,
+		ForgeDuration,
+		ForgeFailures,
+		S3Duration,
+		S3Errors,
+	}
+}
@@ -0,0 +1,177 @@
+package pointer
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// MaxSize LFS 指针文件的最大字节数，更大的文件不会是指针
+const MaxSize = 1024
+
+var ErrNotPointer = errors.New("not a git lfs pointer")
+
+var versions = []string{
+	"https://git-lfs.github.com/spec/v1",
+	"https://hawser.github.com/spec/v1",
+}
+
+// ValidOID 检查 OID 是否为 64 位小写十六进制的 SHA-256 值
+func ValidOID(oid string) bool {
+	if len(oid) != 64 {
+		return false
+	}
+	for _, ch := range oid {
+		if (ch < '0' || ch > '9') && (ch < 'a' || ch > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Pointer 仓库中 LFS 指针文件记录的对象
+type Pointer struct {
+	OID  string
+	Size int64
+}
+
+// Parse 解析 LFS 指针文件，格式见 https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+func Parse(data []byte) (Pointer, error) {
+	if len(data) > MaxSize {
+		return Pointer{}, ErrNotPointer
+	}
+
+	var p Pointer
+	hasVersion, hasSize := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			return Pointer{}, ErrNotPointer
+		}
+		switch key {
+		case "version":
+			hasVersion = lo.Contains(versions, value)
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok {
+				return Pointer{}, ErrNotPointer
+			}
+			p.OID = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return Pointer{}, ErrNotPointer
+			}
+			p.Size, hasSize = size, true
+		}
+	}
+	if !hasVersion || !hasSize || !ValidOID(p.OID) {
+		return Pointer{}, ErrNotPointer
+	}
+	return p, nil
+}
+
+// Scanner 遍历提交树中的 LFS 指针文件，同一棵树与同一个 blob 只读取一次，
+// 因此遍历大量提交时只需要读取发生变化的部分
+type Scanner struct {
+	seenTrees map[plumbing.Hash]struct{}
+	seenBlobs map[plumbing.Hash]struct{}
+	// partial 为 true 时跳过存储中不存在的树与 blob
+	partial bool
+}
+
+func NewScanner() *Scanner {
+	return &Scanner{
+		seenTrees: map[plumbing.Hash]struct{}{},
+		seenBlobs: map[plumbing.Hash]struct{}{},
+	}
+}
+
+// NewPartialScanner 创建用于只包含部分对象的存储（例如推送的 packfile）的 Scanner，
+// 存储中不存在的树与 blob 视为此前已存在，不会被遍历
+func NewPartialScanner() *Scanner {
+	s := NewScanner()
+	s.partial = true
+	return s
+}
+
+// missing 判断错误是否由对象不在存储中引起，Tree.Tree 会将其转换为 ErrDirectoryNotFound
+func (s *Scanner) missing(err error) bool {
+	return s.partial && (errors.Is(err, plumbing.ErrObjectNotFound) || errors.Is(err, object.ErrDirectoryNotFound))
+}
+
+// ScanCommit 对提交树中每个此前未见过的指针文件调用 fn，path 为指针文件在仓库中的路径
+func (s *Scanner) ScanCommit(c *object.Commit, fn func(path string, p Pointer) error) error {
+	tree, err := c.Tree()
+	if s.missing(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read tree of commit %s", c.Hash)
+	}
+	return s.scanTree(tree, "", fn)
+}
+
+func (s *Scanner) scanTree(tree *object.Tree, dir string, fn func(path string, p Pointer) error) error {
+	if _, ok := s.seenTrees[tree.Hash]; ok {
+		return nil
+	}
+	s.seenTrees[tree.Hash] = struct{}{}
+
+	for _, entry := range tree.Entries {
+		path := dir + entry.Name
+		switch entry.Mode {
+		case filemode.Dir:
+			sub, err := tree.Tree(entry.Name)
+			if s.missing(err) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "read tree %s", path)
+			}
+			if err := s.scanTree(sub, path+"/", fn); err != nil {
+				return err
+			}
+		case filemode.Regular, filemode.Executable:
+			if _, ok := s.seenBlobs[entry.Hash]; ok {
+				continue
+			}
+			s.seenBlobs[entry.Hash] = struct{}{}
+
+			p, err := s.readBlob(tree, entry)
+			if errors.Is(err, ErrNotPointer) || s.missing(err) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "read blob %s", path)
+			}
+			if err := fn(path, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) readBlob(tree *object.Tree, entry object.TreeEntry) (Pointer, error) {
+	file, err := tree.TreeEntryFile(&entry)
+	if err != nil {
+		return Pointer{}, err
+	}
+	if file.Size > MaxSize {
+		return Pointer{}, ErrNotPointer
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return Pointer{}, err
+	}
+	return Parse([]byte(contents))
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid repository path")
+
+// Repo 仓库标识，Owner 可以包含多级命名空间，例如 GitLab 的 group/subgroup
+type Repo struct {
+	Owner string
+	Name  string
+}
+
+// Parse 解析形如 owner/name、group/sub/name 或带 .git 后缀的仓库路径
+func Parse(path string) (Repo, error) {
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 {
+		return Repo{}, ErrInvalidPath
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return Repo{}, ErrInvalidPath
+		}
+	}
+	return Repo{
+		Owner: strings.Join(parts[:len(parts)-1], "/"),
+		Name:  parts[len(parts)-1],
+	}, nil
+}
+
+// String 返回 owner/name 形式的仓库路径，同时也是仓库在存储中的键前缀
+func (r Repo) String() string {
+	return r.Owner + "/" + r.Name
+}
@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		path string
+		want Repo
+		err  error
+	}{
+		{path: "owner/name", want: Repo{Owner: "owner", Name: "name"}},
+		{path: "/owner/name/", want: Repo{Owner: "owner", Name: "name"}},
+		{path: "owner/name.git", want: Repo{Owner: "owner", Name: "name"}},
+		{path: "group/sub/name.git", want: Repo{Owner: "group/sub", Name: "name"}},
+		{path: "name", err: ErrInvalidPath},
+		{path: "", err: ErrInvalidPath},
+		{path: "owner//name", err: ErrInvalidPath},
+		{path: "owner/..", err: ErrInvalidPath},
+		{path: "../name", err: ErrInvalidPath},
+		{path: "owner/./name", err: ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.path)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.path, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRepoString(t *testing.T) {
+	r := Repo{Owner: "group/sub", Name: "name"}
+	if got := r.String(); got != "group/sub/name" {
+		t.Errorf("String() = %q, want %q", got, "group/sub/name")
+	}
+}
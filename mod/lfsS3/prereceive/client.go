@@ -0,0 +1,65 @@
+package prereceive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/pkg/errors"
+)
+
+// PathSuffix 检查接口相对于仓库路径的后缀
+const PathSuffix = "/info/lfs/hooks/pre-receive"
+
+type Response struct {
+	Missing []Missing `json:"missing"`
+}
+
+// Client 调用运行中服务的检查接口，供 git 的 pre-receive 钩子使用
+type Client struct {
+	// URL 服务的 LFS 地址，包含挂载前缀，例如 https://lfs.example.com/lfs
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// Check 上传推送新增对象的 packfile 并返回缺失的对象
+func (c *Client) Check(ctx context.Context, r repo.Repo, oldRev, newRev string, pack io.Reader) ([]Missing, error) {
+	url := fmt.Sprintf("%s/%s%s?old=%s&new=%s", c.URL, r, PathSuffix, oldRev, newRev)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pack)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-git-packfile")
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, errors.Errorf("%s: %s", resp.Status, e.Message)
+	}
+	var result Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode response")
+	}
+	return result.Missing, nil
+}
@@ -0,0 +1,136 @@
+package prereceive
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/gitrepo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/pkg/errors"
+)
+
+// Missing 推送的提交中引用了但存储中不存在的对象
+type Missing struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+	// Path 指针文件在仓库中的路径
+	Path string `json:"path"`
+	// Commit 首个被发现引用该对象的提交
+	Commit string `json:"commit"`
+}
+
+// ExistsFunc 检查对象是否存在于存储中
+type ExistsFunc func(ctx context.Context, oid string) (bool, error)
+
+// PackError packfile 或其中的提交无法解析，属于推送内容本身的问题，
+// Check 返回的其他错误（如 ExistsFunc 的存储错误）与推送内容无关
+type PackError struct {
+	Err error
+}
+
+func (e *PackError) Error() string { return e.Err.Error() }
+
+func (e *PackError) Unwrap() error { return e.Err }
+
+// Check 从推送的 packfile 中读取 oldRev 到 newRev 之间新增的提交，检查其中的 LFS 指针引用的对象是否都已上传。
+// packfile 只需包含推送新增的对象（git pack-objects --revs 配合 <newRev> --not --all），
+// 不在 packfile 中的提交、树与 blob 视为推送前已存在，不再检查；oldRev 为零值时表示新建引用
+func Check(ctx context.Context, pack io.Reader, oldRev, newRev plumbing.Hash, exists ExistsFunc) ([]Missing, error) {
+	if newRev.IsZero() {
+		// 删除引用不会引入新的对象
+		return nil, nil
+	}
+
+	r, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "init repository")
+	}
+	br := bufio.NewReader(pack)
+	if _, err := br.Peek(1); err == nil {
+		if err := packfile.UpdateObjectStorage(r.Storer, br); err != nil {
+			return nil, &PackError{Err: errors.Wrap(err, "read packfile")}
+		}
+	}
+
+	// packfile 中包含 oldRev 及其祖先时不检查这些提交
+	seen := map[plumbing.Hash]struct{}{}
+	if !oldRev.IsZero() {
+		if err := walk(r, oldRev, seen, nil); err != nil {
+			return nil, &PackError{Err: err}
+		}
+	}
+
+	var missing []Missing
+	var existsErr error
+	checked := map[string]struct{}{}
+	scanner := pointer.NewPartialScanner()
+	err = walk(r, newRev, seen, func(c *object.Commit) error {
+		return scanner.ScanCommit(c, func(path string, p pointer.Pointer) error {
+			if _, ok := checked[p.OID]; ok {
+				return nil
+			}
+			checked[p.OID] = struct{}{}
+			ok, err := exists(ctx, p.OID)
+			if err != nil {
+				existsErr = errors.Wrapf(err, "check %s", p.OID)
+				return existsErr
+			}
+			if !ok {
+				missing = append(missing, Missing{OID: p.OID, Size: p.Size, Path: path, Commit: c.Hash.String()})
+			}
+			return nil
+		})
+	})
+	if existsErr != nil {
+		return nil, existsErr
+	}
+	if err != nil {
+		// 遍历提交与读取树、blob 失败
+		return nil, &PackError{Err: err}
+	}
+	return missing, nil
+}
+
+// walk 从 rev 开始遍历 packfile 中的提交并记录到 seen，已见过或不在 packfile 中的提交及其祖先不会被遍历
+func walk(r *git.Repository, rev plumbing.Hash, seen map[plumbing.Hash]struct{}, fn func(*object.Commit) error) error {
+	c, err := gitrepo.PeelCommit(r, rev)
+	if errors.Is(err, plumbing.ErrObjectNotFound) || (err == nil && c == nil) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "resolve %s", rev)
+	}
+
+	queue := []*object.Commit{c}
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, ok := seen[c.Hash]; ok {
+			continue
+		}
+		seen[c.Hash] = struct{}{}
+
+		if fn != nil {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		for _, h := range c.ParentHashes {
+			parent, err := r.CommitObject(h)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "read parent %s of %s", h, c.Hash)
+			}
+			queue = append(queue, parent)
+		}
+	}
+	return nil
+}
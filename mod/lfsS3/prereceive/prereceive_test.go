@@ -0,0 +1,196 @@
+package prereceive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/pkg/errors"
+)
+
+var (
+	oid1 = strings.Repeat("1", 64)
+	oid2 = strings.Repeat("2", 64)
+	oid3 = strings.Repeat("3", 64)
+)
+
+// history 在内存中构造提交历史，并按需打包其中的部分对象
+type history struct {
+	t       *testing.T
+	storage *memory.Storage
+}
+
+type encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+func (h *history) store(o encoder, typ plumbing.ObjectType) plumbing.Hash {
+	h.t.Helper()
+	obj := h.storage.NewEncodedObject()
+	obj.SetType(typ)
+	if err := o.Encode(obj); err != nil {
+		h.t.Fatal(err)
+	}
+	hash, err := h.storage.SetEncodedObject(obj)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return hash
+}
+
+func (h *history) blob(content string) plumbing.Hash {
+	h.t.Helper()
+	obj := h.storage.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		h.t.Fatal(err)
+	}
+	hash, err := h.storage.SetEncodedObject(obj)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return hash
+}
+
+func pointerFile(oid string, size int64) string {
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, size)
+}
+
+// tree 创建树，entries 必须按名称排序
+func (h *history) tree(entries ...object.TreeEntry) plumbing.Hash {
+	return h.store(&object.Tree{Entries: entries}, plumbing.TreeObject)
+}
+
+func (h *history) commit(tree plumbing.Hash, parents ...plumbing.Hash) plumbing.Hash {
+	sig := object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)}
+	return h.store(&object.Commit{Author: sig, Committer: sig, Message: "test", TreeHash: tree, ParentHashes: parents}, plumbing.CommitObject)
+}
+
+func (h *history) pack(hashes ...plumbing.Hash) []byte {
+	h.t.Helper()
+	var buf bytes.Buffer
+	if _, err := packfile.NewEncoder(&buf, h.storage, false).Encode(hashes, 10); err != nil {
+		h.t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheck(t *testing.T) {
+	h := &history{t: t, storage: memory.NewStorage()}
+	// 第一个提交引用已上传的 oid1 与缺失的 oid2，第二个提交新增缺失的 oid3
+	readme := h.blob("readme\n")
+	p1, p2, p3 := h.blob(pointerFile(oid1, 1)), h.blob(pointerFile(oid2, 2)), h.blob(pointerFile(oid3, 3))
+	assets := h.tree(
+		object.TreeEntry{Name: "a.bin", Mode: filemode.Regular, Hash: p1},
+		object.TreeEntry{Name: "b.bin", Mode: filemode.Regular, Hash: p2},
+	)
+	root1 := h.tree(
+		object.TreeEntry{Name: "README", Mode: filemode.Regular, Hash: readme},
+		object.TreeEntry{Name: "assets", Mode: filemode.Dir, Hash: assets},
+	)
+	c1 := h.commit(root1)
+	root2 := h.tree(
+		object.TreeEntry{Name: "README", Mode: filemode.Regular, Hash: readme},
+		object.TreeEntry{Name: "assets", Mode: filemode.Dir, Hash: assets},
+		object.TreeEntry{Name: "c.bin", Mode: filemode.Executable, Hash: p3},
+	)
+	c2 := h.commit(root2, c1)
+
+	uploaded := map[string]bool{oid1: true}
+	exists := func(_ context.Context, oid string) (bool, error) {
+		return uploaded[oid], nil
+	}
+
+	tests := []struct {
+		name           string
+		pack           []byte
+		oldRev, newRev plumbing.Hash
+		want           []Missing
+	}{
+		{
+			name:   "new ref",
+			pack:   h.pack(readme, p1, p2, p3, assets, root1, c1, root2, c2),
+			newRev: c2,
+			want: []Missing{
+				{OID: oid2, Size: 2, Path: "assets/b.bin", Commit: c2.String()},
+				{OID: oid3, Size: 3, Path: "c.bin", Commit: c2.String()},
+			},
+		},
+		{
+			// packfile 只包含推送新增的对象，之前的提交与未改动的目录不再检查
+			name:   "update ref",
+			pack:   h.pack(p3, root2, c2),
+			oldRev: c1,
+			newRev: c2,
+			want:   []Missing{{OID: oid3, Size: 3, Path: "c.bin", Commit: c2.String()}},
+		},
+		{
+			name:   "old commit in pack",
+			pack:   h.pack(readme, p1, p2, assets, root1, c1),
+			oldRev: c1,
+			newRev: c1,
+		},
+		{name: "new commit not in pack", pack: nil, oldRev: c1, newRev: c2},
+		{name: "delete ref", pack: []byte("not a pack"), oldRev: c2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := Check(context.Background(), bytes.NewReader(tt.pack), tt.oldRev, tt.newRev, exists)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(missing, tt.want) {
+				t.Errorf("Check() = %+v, want %+v", missing, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	h := &history{t: t, storage: memory.NewStorage()}
+	p := h.blob(pointerFile(oid1, 1))
+	c := h.commit(h.tree(object.TreeEntry{Name: "a.bin", Mode: filemode.Regular, Hash: p}))
+	pack := h.pack(p, h.tree(object.TreeEntry{Name: "a.bin", Mode: filemode.Regular, Hash: p}), c)
+
+	errStorage := errors.New("storage unavailable")
+	failing := func(context.Context, string) (bool, error) {
+		return false, errStorage
+	}
+	never := func(context.Context, string) (bool, error) {
+		t.Error("exists called for an invalid pack")
+		return false, nil
+	}
+
+	_, err := Check(context.Background(), strings.NewReader("not a pack"), plumbing.ZeroHash, c, never)
+	var packErr *PackError
+	if !errors.As(err, &packErr) {
+		t.Errorf("Check() with a corrupt pack = %v, want a PackError", err)
+	}
+
+	_, err = Check(context.Background(), bytes.NewReader(pack[:len(pack)/2]), plumbing.ZeroHash, c, never)
+	if !errors.As(err, &packErr) {
+		t.Errorf("Check() with a truncated pack = %v, want a PackError", err)
+	}
+
+	// 存储错误与推送内容无关，不能被当作无效的 packfile
+	_, err = Check(context.Background(), bytes.NewReader(pack), plumbing.ZeroHash, c, failing)
+	if !errors.Is(err, errStorage) || errors.As(err, &packErr) {
+		t.Errorf("Check() with a failing storage = %v, want the storage error", err)
+	}
+}
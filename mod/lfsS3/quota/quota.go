@@ -0,0 +1,386 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/juanjiTech/jframe/core/logx"
+	"github.com/pkg/errors"
+)
+
+// Limit 配额上限，为 0 时表示不限制
+type Limit struct {
+	MaxBytes   int64 `yaml:"maxBytes"`
+	MaxObjects int64 `yaml:"maxObjects"`
+}
+
+type RepoLimit struct {
+	Repo       string `yaml:"repo"`
+	MaxBytes   int64  `yaml:"maxBytes"`
+	MaxObjects int64  `yaml:"maxObjects"`
+}
+
+// OwnerLimit 命名空间配额，包含该命名空间及其子命名空间下的所有仓库
+type OwnerLimit struct {
+	Owner      string `yaml:"owner"`
+	MaxBytes   int64  `yaml:"maxBytes"`
+	MaxObjects int64  `yaml:"maxObjects"`
+}
+
+type Config struct {
+	Enable bool `yaml:"enable"`
+	// DefaultRepo 未单独配置的仓库使用的配额
+	DefaultRepo Limit `yaml:"defaultRepo"`
+	// DefaultOwner 未单独配置的命名空间使用的配额
+	DefaultOwner Limit        `yaml:"defaultOwner"`
+	Repos        []RepoLimit  `yaml:"repos"`
+	Owners       []OwnerLimit `yaml:"owners"`
+	// RecomputeInterval 定期扫描存储桶重新计算用量的间隔（秒），默认 3600，小于 0 时只在启动时计算
+	RecomputeInterval int `yaml:"recomputeInterval"`
+}
+
+// defaultRecomputeInterval 未调用校验接口的上传只能通过重新扫描计入，因此默认定期扫描
+const defaultRecomputeInterval = 3600
+
+func (c Config) recomputeInterval() time.Duration {
+	if c.RecomputeInterval == 0 {
+		return defaultRecomputeInterval * time.Second
+	}
+	return time.Duration(c.RecomputeInterval) * time.Second
+}
+
+type Usage struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Scan 扫描整个存储桶，按对象所在的键前缀统计每个仓库的用量，只支持按仓库存放的布局，
+// 按内容寻址的对象不属于任何仓库，不会被统计
+func Scan(ctx context.Context, s *storage.S3Storage) (map[string]Usage, error) {
+	return scan(ctx, s, func(repo.Repo, string) {})
+}
+
+// scan 统计用量并对每个计入的对象调用 visit
+func scan(ctx context.Context, s *storage.S3Storage, visit func(r repo.Repo, oid string)) (map[string]Usage, error) {
+	usages := map[string]Usage{}
+	err := s.WalkObjects(ctx, "", func(info storage.ObjectInfo) error {
+		r, oid, ok := storage.LayoutRepo.ParseKey(info.Key)
+		if !ok {
+			return nil
+		}
+		u := usages[r.String()]
+		u.Objects++
+		u.Bytes += info.Size
+		usages[r.String()] = u
+		visit(*r, oid)
+		return nil
+	})
+	return usages, err
+}
+
+// pendingTTL 批量请求允许上传后等待校验的最长时间，大于上传地址的有效期
+const pendingTTL = 2 * time.Hour
+
+// scope 一个生效的配额范围
+type scope struct {
+	name   string
+	prefix string // 属于该范围的仓库路径前缀，仓库范围时为空
+	limit  Limit
+}
+
+// Tracker 在内存中维护各仓库的用量，上传校验通过后增量更新，并定期通过扫描存储桶纠正偏差
+type Tracker struct {
+	config  Config
+	storage *storage.S3Storage
+	repos   map[string]Limit
+	owners  map[string]Limit
+
+	mu        sync.RWMutex
+	usages    map[string]Usage
+	ready     bool
+	scannedAt time.Time
+	// pending 批量请求中确认不存在并允许上传的对象，校验通过时才计入用量，因此每个对象只计入一次；
+	// 在计入之前同样占用配额，避免并发的批量请求各自用完剩余配额
+	pending map[string]pendingObject
+	sweptAt time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewTracker(cfg Config, s *storage.S3Storage) (*Tracker, error) {
+	t := &Tracker{
+		config:  cfg,
+		storage: s,
+		repos:   map[string]Limit{},
+		owners:  map[string]Limit{},
+		usages:  map[string]Usage{},
+		pending: map[string]pendingObject{},
+	}
+	for _, l := range cfg.Repos {
+		r, err := repo.Parse(l.Repo)
+		if err != nil {
+			return nil, errors.Errorf("invalid quota repo %q", l.Repo)
+		}
+		t.repos[r.String()] = Limit{MaxBytes: l.MaxBytes, MaxObjects: l.MaxObjects}
+	}
+	for _, l := range cfg.Owners {
+		owner := strings.Trim(l.Owner, "/")
+		if owner == "" {
+			return nil, errors.Errorf("invalid quota owner %q", l.Owner)
+		}
+		t.owners[owner] = Limit{MaxBytes: l.MaxBytes, MaxObjects: l.MaxObjects}
+	}
+	return t, nil
+}
+
+func (t *Tracker) Enabled() bool {
+	return t.config.Enable
+}
+
+// Start 在后台计算初始用量并按配置定期重新计算，初始用量计算完成前不限制上传
+func (t *Tracker) Start() {
+	if !t.Enabled() {
+		return
+	}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		var tick <-chan time.Time
+		if interval := t.config.recomputeInterval(); interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			if err := t.Recompute(context.Background()); err != nil {
+				logx.NameSpace("quota").Errorw("failed to recompute storage usage", "error", err)
+			}
+			select {
+			case <-t.stop:
+				return
+			case <-tick:
+			}
+		}
+	}()
+}
+
+func (t *Tracker) Stop() {
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+}
+
+// Recompute 扫描存储桶重新计算用量，扫描期间发生的增量更新会被扫描结果覆盖；
+// 扫描到的等待校验的对象已计入扫描结果，不再占用配额
+func (t *Tracker) Recompute(ctx context.Context) error {
+	start := time.Now()
+	var found []string
+	usages, err := scan(ctx, t.storage, func(r repo.Repo, oid string) {
+		found = append(found, pendingKey(r, oid))
+	})
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.usages = usages
+	t.ready = true
+	t.scannedAt = start
+	for _, key := range found {
+		delete(t.pending, key)
+	}
+	t.mu.Unlock()
+	logx.NameSpace("quota").Infow("storage usage recomputed", "repos", len(usages), "duration", time.Since(start).String())
+	return nil
+}
+
+// pendingObject 等待校验的对象
+type pendingObject struct {
+	repo string
+	size int64
+	at   time.Time
+}
+
+// expect 记录允许上传的对象，超过 pendingTTL 仍未校验的记录会被清理，调用方需持有写锁
+func (t *Tracker) expect(r repo.Repo, oid string, size int64) {
+	now := time.Now()
+	if now.Sub(t.sweptAt) > pendingTTL {
+		for key, p := range t.pending {
+			if now.Sub(p.at) > pendingTTL {
+				delete(t.pending, key)
+			}
+		}
+		t.sweptAt = now
+	}
+	t.pending[pendingKey(r, oid)] = pendingObject{repo: r.String(), size: size, at: now}
+}
+
+// Add 记录上传校验通过的对象，只计入通过 Reservation.Add 记录的对象且只计入一次，重复的校验请求
+// 与已存在对象的重新上传不会重复计算；扫描开始前写入的对象已计入扫描结果，同样不再计算
+func (t *Tracker) Add(r repo.Repo, oid string, info storage.ObjectInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := pendingKey(r, oid)
+	if _, ok := t.pending[key]; !ok {
+		return
+	}
+	delete(t.pending, key)
+	if info.LastModified.Before(t.scannedAt) {
+		return
+	}
+	u := t.usages[r.String()]
+	u.Objects++
+	u.Bytes += info.Size
+	t.usages[r.String()] = u
+}
+
+func pendingKey(r repo.Repo, oid string) string {
+	return r.String() + "/" + oid
+}
+
+// Usage 返回仓库当前的用量
+func (t *Tracker) Usage(r repo.Repo) Usage {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.usages[r.String()]
+}
+
+func (t *Tracker) scopes(r repo.Repo) []scope {
+	limit, ok := t.repos[r.String()]
+	if !ok {
+		limit = t.config.DefaultRepo
+	}
+	scopes := []scope{{name: "repository " + r.String(), limit: limit}}
+
+	matched := false
+	for owner, limit := range t.owners {
+		if r.Owner == owner || strings.HasPrefix(r.Owner, owner+"/") {
+			scopes = append(scopes, scope{name: "owner " + owner, prefix: owner + "/", limit: limit})
+			matched = true
+		}
+	}
+	if !matched {
+		scopes = append(scopes, scope{name: "owner " + r.Owner, prefix: r.Owner + "/", limit: t.config.DefaultOwner})
+	}
+	return scopes
+}
+
+// usage 统计一个配额范围内的用量，包含等待校验的对象，调用方需持有读锁
+func (t *Tracker) usage(r repo.Repo, s scope) Usage {
+	in := func(name string) bool {
+		if s.prefix == "" {
+			return name == r.String()
+		}
+		return strings.HasPrefix(name, s.prefix)
+	}
+	var total Usage
+	for name, u := range t.usages {
+		if in(name) {
+			total.Objects += u.Objects
+			total.Bytes += u.Bytes
+		}
+	}
+	for _, p := range t.pending {
+		if in(p.repo) {
+			total.Objects++
+			total.Bytes += p.size
+		}
+	}
+	return total
+}
+
+// ExceededError 配额不足时返回的错误
+type ExceededError struct {
+	Scope string
+	Limit Limit
+	Usage Usage
+	// Size 请求上传的对象大小，检查仓库是否已用尽配额时为 0
+	Size int64
+}
+
+func (e *ExceededError) Error() string {
+	if e.Limit.MaxObjects > 0 && e.Usage.Objects >= e.Limit.MaxObjects {
+		return fmt.Sprintf("object quota exceeded for %s: %d of %d objects used", e.Scope, e.Usage.Objects, e.Limit.MaxObjects)
+	}
+	if e.Size > 0 {
+		return fmt.Sprintf("storage quota exceeded for %s: %d of %d bytes used, %d bytes requested", e.Scope, e.Usage.Bytes, e.Limit.MaxBytes, e.Size)
+	}
+	return fmt.Sprintf("storage quota exceeded for %s: %d of %d bytes used", e.Scope, e.Usage.Bytes, e.Limit.MaxBytes)
+}
+
+// Reservation 为一次批量请求中的上传预留配额，已预留的对象在校验或过期前占用配额，
+// 因此同一批次中的后续对象与并发的其他批量请求都会计入
+type Reservation struct {
+	tracker *Tracker
+	repo    repo.Repo
+	scopes  []scope
+}
+
+// Reserve 获取仓库生效的配额范围，未开启配额时不做限制，初始用量尚未计算完成时只记录上传不做限制
+func (t *Tracker) Reserve(r repo.Repo) *Reservation {
+	if !t.Enabled() {
+		return &Reservation{}
+	}
+	res := &Reservation{tracker: t, repo: r}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if !t.ready {
+		return res
+	}
+	for _, s := range t.scopes(r) {
+		if s.limit.MaxBytes <= 0 && s.limit.MaxObjects <= 0 {
+			continue
+		}
+		res.scopes = append(res.scopes, s)
+	}
+	return res
+}
+
+// Full 检查是否已有配额范围用尽，返回对应的错误
+func (res *Reservation) Full() error {
+	if res.tracker == nil {
+		return nil
+	}
+	res.tracker.mu.RLock()
+	defer res.tracker.mu.RUnlock()
+	for _, s := range res.scopes {
+		u := res.tracker.usage(res.repo, s)
+		if (s.limit.MaxBytes > 0 && u.Bytes >= s.limit.MaxBytes) || (s.limit.MaxObjects > 0 && u.Objects >= s.limit.MaxObjects) {
+			return &ExceededError{Scope: s.name, Limit: s.limit, Usage: u}
+		}
+	}
+	return nil
+}
+
+// Add 尝试为一个大小为 size 的新对象预留配额，超出任一配额范围时返回错误且不预留；
+// 已预留的对象再次预留时先释放原来的预留
+func (res *Reservation) Add(oid string, size int64) error {
+	if res.tracker == nil {
+		return nil
+	}
+	t := res.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := pendingKey(res.repo, oid)
+	prev, reserved := t.pending[key]
+	delete(t.pending, key)
+	for _, s := range res.scopes {
+		u := t.usage(res.repo, s)
+		if (s.limit.MaxBytes > 0 && u.Bytes+size > s.limit.MaxBytes) || (s.limit.MaxObjects > 0 && u.Objects+1 > s.limit.MaxObjects) {
+			if reserved {
+				t.pending[key] = prev
+			}
+			return &ExceededError{Scope: s.name, Limit: s.limit, Usage: u, Size: size}
+		}
+	}
+	t.expect(res.repo, oid, size)
+	return nil
+}
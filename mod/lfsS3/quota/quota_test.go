@@ -0,0 +1,236 @@
+package quota
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+)
+
+func oid(c string) string {
+	return strings.Repeat(c, 64)
+}
+
+// newTracker 创建已完成初始扫描的 Tracker
+func newTracker(t *testing.T, cfg Config, usages map[string]Usage) *Tracker {
+	t.Helper()
+	cfg.Enable = true
+	tr, err := NewTracker(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.usages = usages
+	tr.ready = true
+	tr.scannedAt = time.Now()
+	return tr
+}
+
+type reserve struct {
+	repo repo.Repo
+	oid  string
+	size int64
+	// scope 预期超出的配额范围，为空时预期预留成功
+	scope string
+}
+
+func TestReservationAdd(t *testing.T) {
+	a := repo.Repo{Owner: "group", Name: "a"}
+	b := repo.Repo{Owner: "group/sub", Name: "b"}
+	c := repo.Repo{Owner: "other", Name: "c"}
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		usages   map[string]Usage
+		reserves []reserve
+	}{
+		{
+			name:   "repo bytes",
+			cfg:    Config{DefaultRepo: Limit{MaxBytes: 40}},
+			usages: map[string]Usage{"group/a": {Objects: 1, Bytes: 30}},
+			reserves: []reserve{
+				{repo: a, oid: oid("1"), size: 11, scope: "repository group/a"},
+				{repo: a, oid: oid("1"), size: 10},
+				// 已预留的对象占用配额
+				{repo: a, oid: oid("2"), size: 1, scope: "repository group/a"},
+				// 其他仓库不受影响
+				{repo: b, oid: oid("2"), size: 40},
+			},
+		},
+		{
+			name: "repo objects",
+			cfg:  Config{DefaultRepo: Limit{MaxObjects: 2}},
+			reserves: []reserve{
+				{repo: a, oid: oid("1"), size: 1},
+				{repo: a, oid: oid("2"), size: 1},
+				{repo: a, oid: oid("3"), size: 1, scope: "repository group/a"},
+			},
+		},
+		{
+			name: "reserve again replaces the previous reservation",
+			cfg:  Config{DefaultRepo: Limit{MaxBytes: 10}},
+			reserves: []reserve{
+				{repo: a, oid: oid("1"), size: 10},
+				{repo: a, oid: oid("1"), size: 8},
+				{repo: a, oid: oid("2"), size: 2},
+				{repo: a, oid: oid("1"), size: 9, scope: "repository group/a"},
+				// 失败的预留保留原来的预留
+				{repo: a, oid: oid("3"), size: 1, scope: "repository group/a"},
+			},
+		},
+		{
+			name: "owner includes sub owners",
+			cfg: Config{
+				Owners: []OwnerLimit{{Owner: "/group/", MaxBytes: 100}},
+			},
+			usages: map[string]Usage{"group/a": {Objects: 1, Bytes: 50}, "other/c": {Objects: 1, Bytes: 1000}},
+			reserves: []reserve{
+				{repo: b, oid: oid("1"), size: 40},
+				{repo: a, oid: oid("2"), size: 11, scope: "owner group"},
+				{repo: a, oid: oid("2"), size: 10},
+				{repo: c, oid: oid("3"), size: 1000},
+			},
+		},
+		{
+			name: "repo limit overrides default",
+			cfg: Config{
+				DefaultRepo: Limit{MaxBytes: 10},
+				Repos:       []RepoLimit{{Repo: "group/a.git", MaxBytes: 100}},
+			},
+			reserves: []reserve{
+				{repo: a, oid: oid("1"), size: 100},
+				{repo: b, oid: oid("1"), size: 11, scope: "repository group/sub/b"},
+			},
+		},
+		{
+			name:   "default owner",
+			cfg:    Config{DefaultOwner: Limit{MaxObjects: 1}},
+			usages: map[string]Usage{"group/sub/b": {Objects: 1, Bytes: 1}},
+			reserves: []reserve{
+				{repo: c, oid: oid("1"), size: 1},
+				{repo: a, oid: oid("1"), size: 1, scope: "owner group"},
+				{repo: b, oid: oid("1"), size: 1, scope: "owner group/sub"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usages := tt.usages
+			if usages == nil {
+				usages = map[string]Usage{}
+			}
+			tr := newTracker(t, tt.cfg, usages)
+			for i, r := range tt.reserves {
+				err := tr.Reserve(r.repo).Add(r.oid, r.size)
+				var exceeded *ExceededError
+				switch {
+				case r.scope == "" && err != nil:
+					t.Errorf("reserve %d: Add() = %v, want nil", i, err)
+				case r.scope != "" && !errors.As(err, &exceeded):
+					t.Errorf("reserve %d: Add() = %v, want an ExceededError", i, err)
+				case r.scope != "" && exceeded.Scope != r.scope:
+					t.Errorf("reserve %d: exceeded scope = %q, want %q", i, exceeded.Scope, r.scope)
+				}
+			}
+		})
+	}
+}
+
+func TestReservationUnlimited(t *testing.T) {
+	r := repo.Repo{Owner: "owner", Name: "name"}
+
+	disabled, err := NewTracker(Config{DefaultRepo: Limit{MaxBytes: 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disabled.Reserve(r).Add(oid("1"), 10); err != nil {
+		t.Errorf("Add() with quota disabled = %v, want nil", err)
+	}
+	if len(disabled.pending) != 0 {
+		t.Errorf("quota disabled but %d objects pending", len(disabled.pending))
+	}
+
+	// 初始用量尚未计算完成时不限制，但仍记录上传
+	notReady, err := NewTracker(Config{Enable: true, DefaultRepo: Limit{MaxBytes: 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notReady.Reserve(r).Add(oid("1"), 10); err != nil {
+		t.Errorf("Add() before the initial scan = %v, want nil", err)
+	}
+	if len(notReady.pending) != 1 {
+		t.Errorf("%d objects pending before the initial scan, want 1", len(notReady.pending))
+	}
+}
+
+func TestReservationFull(t *testing.T) {
+	r := repo.Repo{Owner: "owner", Name: "name"}
+	tests := []struct {
+		name  string
+		limit Limit
+		usage Usage
+		full  bool
+	}{
+		{name: "unlimited", usage: Usage{Objects: 100, Bytes: 100}},
+		{name: "below bytes", limit: Limit{MaxBytes: 10}, usage: Usage{Objects: 1, Bytes: 9}},
+		{name: "at bytes", limit: Limit{MaxBytes: 10}, usage: Usage{Objects: 1, Bytes: 10}, full: true},
+		{name: "below objects", limit: Limit{MaxObjects: 2}, usage: Usage{Objects: 1, Bytes: 100}},
+		{name: "at objects", limit: Limit{MaxObjects: 2}, usage: Usage{Objects: 2}, full: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTracker(t, Config{DefaultRepo: tt.limit}, map[string]Usage{r.String(): tt.usage})
+			if err := tr.Reserve(r).Full(); (err != nil) != tt.full {
+				t.Errorf("Full() = %v, want full %v", err, tt.full)
+			}
+		})
+	}
+}
+
+func TestTrackerAdd(t *testing.T) {
+	r := repo.Repo{Owner: "owner", Name: "name"}
+	tr := newTracker(t, Config{DefaultRepo: Limit{MaxBytes: 100}}, map[string]Usage{})
+	now := time.Now()
+
+	// 未通过批量请求预留的对象不计入
+	tr.Add(r, oid("1"), storage.ObjectInfo{Size: 10, LastModified: now})
+	if got := tr.Usage(r); got != (Usage{}) {
+		t.Fatalf("Usage() after an unreserved add = %+v, want zero", got)
+	}
+
+	if err := tr.Reserve(r).Add(oid("1"), 10); err != nil {
+		t.Fatal(err)
+	}
+	tr.Add(r, oid("1"), storage.ObjectInfo{Size: 10, LastModified: now})
+	tr.Add(r, oid("1"), storage.ObjectInfo{Size: 10, LastModified: now})
+	if got, want := tr.Usage(r), (Usage{Objects: 1, Bytes: 10}); got != want {
+		t.Fatalf("Usage() after repeated adds = %+v, want %+v", got, want)
+	}
+	if len(tr.pending) != 0 {
+		t.Fatalf("%d objects still pending after verification, want 0", len(tr.pending))
+	}
+
+	// 扫描开始前写入的对象已计入扫描结果
+	if err := tr.Reserve(r).Add(oid("2"), 20); err != nil {
+		t.Fatal(err)
+	}
+	tr.Add(r, oid("2"), storage.ObjectInfo{Size: 20, LastModified: tr.scannedAt.Add(-time.Second)})
+	if got, want := tr.Usage(r), (Usage{Objects: 1, Bytes: 10}); got != want {
+		t.Fatalf("Usage() after adding an object written before the scan = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewTrackerInvalid(t *testing.T) {
+	tests := []Config{
+		{Repos: []RepoLimit{{Repo: "name"}}},
+		{Owners: []OwnerLimit{{Owner: "/"}}},
+	}
+	for _, cfg := range tests {
+		if _, err := NewTracker(cfg, nil); err == nil {
+			t.Errorf("NewTracker(%+v) succeeded, want error", cfg)
+		}
+	}
+}
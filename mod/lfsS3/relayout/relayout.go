@@ -0,0 +1,293 @@
+package relayout
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// checkpointInterval 保存检查点的间隔
+const checkpointInterval = 5 * time.Second
+
+type Options struct {
+	// Repo 只迁移该仓库，为 nil 时迁移整个存储桶
+	Repo *repo.Repo
+	// Layout 目标布局
+	Layout storage.Layout
+	// Target 目标存储桶，为 nil 时复制到源存储桶
+	Target   *storage.S3Storage
+	Parallel int
+	// Checkpoint 检查点文件，不为空时从中断处继续并定期保存进度
+	Checkpoint string
+	// OnError 复制单个对象失败时调用，调用是串行的
+	OnError func(key string, err error)
+}
+
+type Result struct {
+	Objects int64
+	Bytes   int64
+	Copied  int64
+	// Skipped 目标中已存在且大小与 ETag 一致的对象
+	Skipped int64
+	Failed  int64
+}
+
+// Checkpoint 迁移进度，源存储桶中键不大于 After 的对象均已复制并校验
+type Checkpoint struct {
+	SourceBucket string         `json:"source_bucket"`
+	TargetBucket string         `json:"target_bucket"`
+	Layout       storage.Layout `json:"layout"`
+	Prefix       string         `json:"prefix"`
+	After        string         `json:"after"`
+}
+
+// Run 遍历按仓库存放（storage.LayoutRepo）的对象，在服务端复制到目标布局与存储桶，
+// 复制后比较大小与 ETag，源对象保持不变以便双读期间回退读取
+func Run(ctx context.Context, source *storage.S3Storage, opts Options) (*Result, error) {
+	target := opts.Target
+	if target == nil {
+		target = source
+	}
+	if opts.Layout == storage.LayoutRepo && target.BucketName() == source.BucketName() {
+		return nil, errors.New("target layout and bucket are the same as the source")
+	}
+
+	prefix := ""
+	if opts.Repo != nil {
+		prefix = opts.Repo.String() + "/"
+	}
+	checkpoint := Checkpoint{
+		SourceBucket: source.BucketName(),
+		TargetBucket: target.BucketName(),
+		Layout:       opts.Layout,
+		Prefix:       prefix,
+	}
+	if opts.Checkpoint != "" {
+		saved, err := loadCheckpoint(opts.Checkpoint)
+		if err != nil {
+			return nil, err
+		}
+		if saved != nil {
+			if saved.SourceBucket != checkpoint.SourceBucket || saved.TargetBucket != checkpoint.TargetBucket ||
+				saved.Layout != checkpoint.Layout || saved.Prefix != checkpoint.Prefix {
+				return nil, errors.Errorf("checkpoint %s was created for a different migration", opts.Checkpoint)
+			}
+			checkpoint.After = saved.After
+		}
+	}
+
+	result := &Result{}
+	p := &progress{after: checkpoint.After, keys: map[int64]string{}, done: map[int64]string{}}
+	var mu sync.Mutex
+	report := func(key string, size int64, copied bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Objects++
+		switch {
+		case err != nil:
+			result.Failed++
+			if opts.OnError != nil {
+				opts.OnError(key, err)
+			}
+		case copied:
+			result.Copied++
+			result.Bytes += size
+		default:
+			result.Skipped++
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	type job struct {
+		seq  int64
+		info storage.ObjectInfo
+		r    repo.Repo
+	}
+	jobs := make(chan job)
+	g.Go(func() error {
+		defer close(jobs)
+		return source.WalkObjectsAfter(gctx, prefix, checkpoint.After, func(info storage.ObjectInfo) error {
+			if strings.HasPrefix(info.Key, storage.ReservedPrefix) {
+				return nil
+			}
+			// 只迁移仓库本身的对象，子命名空间下的仓库不包含在内
+			if opts.Repo != nil && strings.Contains(strings.TrimPrefix(info.Key, prefix), "/") {
+				return nil
+			}
+			r, err := repo.Parse(path.Dir(info.Key))
+			if err != nil || !pointer.ValidOID(path.Base(info.Key)) {
+				return nil
+			}
+			j := job{seq: p.add(info.Key), info: info, r: r}
+			select {
+			case jobs <- j:
+				return nil
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		})
+	})
+	for range max(opts.Parallel, 1) {
+		g.Go(func() error {
+			for j := range jobs {
+				copied, err := copyObject(gctx, source, target, j.info, opts.Layout.Key(j.r, path.Base(j.info.Key)))
+				report(j.info.Key, j.info.Size, copied, err)
+				if err == nil {
+					p.complete(j.seq)
+				}
+			}
+			return gctx.Err()
+		})
+	}
+
+	if opts.Checkpoint == "" {
+		return result, g.Wait()
+	}
+
+	// 定期保存检查点，复制结束后再保存一次
+	stop := make(chan struct{})
+	saved := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				saved <- nil
+				return
+			case <-ticker.C:
+				c := checkpoint
+				c.After = p.watermark()
+				if err := saveCheckpoint(opts.Checkpoint, c); err != nil {
+					saved <- err
+					return
+				}
+			}
+		}
+	}()
+	err := g.Wait()
+	close(stop)
+	if saveErr := <-saved; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	checkpoint.After = p.watermark()
+	if saveErr := saveCheckpoint(opts.Checkpoint, checkpoint); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return result, err
+}
+
+// copyObject 将对象复制到目标键并校验，目标中已存在一致的对象时跳过
+func copyObject(ctx context.Context, source, target *storage.S3Storage, info storage.ObjectInfo, dst string) (bool, error) {
+	existing, err := target.StatObject(ctx, dst)
+	if err == nil && sameObject(info, existing) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return false, err
+	}
+
+	if err := target.CopyObject(ctx, source.BucketName(), info.Key, dst, info.Size); err != nil {
+		return false, err
+	}
+	copied, err := target.StatObject(ctx, dst)
+	if err != nil {
+		return false, errors.Wrap(err, "verify copy")
+	}
+	if !sameObject(info, copied) {
+		_ = target.DeleteObject(ctx, dst)
+		return false, errors.Errorf("verify copy: got size %d and ETag %s, expected size %d and ETag %s",
+			copied.Size, copied.ETag, info.Size, info.ETag)
+	}
+	return true, nil
+}
+
+// sameObject 比较大小与 ETag，分片上传或分片复制的 ETag 与分片方式有关，只比较大小
+func sameObject(src, dst storage.ObjectInfo) bool {
+	if src.Size != dst.Size {
+		return false
+	}
+	if strings.Contains(src.ETag, "-") || strings.Contains(dst.ETag, "-") {
+		return true
+	}
+	return src.ETag == dst.ETag
+}
+
+// progress 记录已完成的对象，并发复制时只有之前的对象全部完成后检查点才会前进
+type progress struct {
+	mu    sync.Mutex
+	seq   int64
+	next  int64
+	after string
+	done  map[int64]string
+	keys  map[int64]string
+}
+
+func (p *progress) add(key string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seq := p.seq
+	p.keys[seq] = key
+	p.seq++
+	return seq
+}
+
+func (p *progress) complete(seq int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[seq] = p.keys[seq]
+	delete(p.keys, seq)
+	for {
+		key, ok := p.done[p.next]
+		if !ok {
+			return
+		}
+		delete(p.done, p.next)
+		p.after = key
+		p.next++
+	}
+}
+
+func (p *progress) watermark() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.after
+}
+
+func loadCheckpoint(file string) (*Checkpoint, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read checkpoint")
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrap(err, "parse checkpoint")
+	}
+	return &c, nil
+}
+
+// saveCheckpoint 先写入临时文件再重命名，避免中断时留下不完整的检查点
+func saveCheckpoint(file string, c Checkpoint) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return errors.Wrap(err, "write checkpoint")
+	}
+	return errors.Wrap(os.Rename(tmp, file), "write checkpoint")
+}
@@ -0,0 +1,99 @@
+package relayout
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+)
+
+func TestProgressWatermark(t *testing.T) {
+	tests := []struct {
+		name string
+		// complete 依次完成的对象序号，不在其中的对象视为复制失败
+		complete []int64
+		want     []string
+	}{
+		{name: "in order", complete: []int64{0, 1, 2, 3}, want: []string{"a", "b", "c", "d"}},
+		{name: "out of order", complete: []int64{2, 1, 3, 0}, want: []string{"start", "start", "start", "d"}},
+		{name: "gap", complete: []int64{0, 2, 3, 1}, want: []string{"a", "a", "a", "d"}},
+		{name: "failed object", complete: []int64{0, 2, 3}, want: []string{"a", "a", "a"}},
+		{name: "nothing completed", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &progress{after: "start", keys: map[int64]string{}, done: map[int64]string{}}
+			seqs := map[int64]int64{}
+			for i, key := range []string{"a", "b", "c", "d"} {
+				seqs[int64(i)] = p.add(key)
+			}
+			for i, seq := range tt.complete {
+				p.complete(seqs[seq])
+				if got := p.watermark(); got != tt.want[i] {
+					t.Errorf("watermark after completing %v = %q, want %q", tt.complete[:i+1], got, tt.want[i])
+				}
+			}
+			if len(tt.complete) == 0 && p.watermark() != "start" {
+				t.Errorf("watermark = %q, want %q", p.watermark(), "start")
+			}
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	saved, err := loadCheckpoint(file)
+	if err != nil || saved != nil {
+		t.Fatalf("loadCheckpoint() of a missing file = %v, %v, want nil, nil", saved, err)
+	}
+
+	want := Checkpoint{
+		SourceBucket: "src",
+		TargetBucket: "dst",
+		Layout:       storage.LayoutContent,
+		Prefix:       "owner/name/",
+		After:        "owner/name/" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+	if err := saveCheckpoint(file, want); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary checkpoint file left behind: %v", err)
+	}
+	saved, err = loadCheckpoint(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil || *saved != want {
+		t.Errorf("loadCheckpoint() = %+v, want %+v", saved, want)
+	}
+
+	if err := os.WriteFile(file, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(file); err == nil {
+		t.Error("loadCheckpoint() of a corrupt file succeeded, want error")
+	}
+}
+
+func TestSameObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst storage.ObjectInfo
+		want     bool
+	}{
+		{name: "same", src: storage.ObjectInfo{Size: 4, ETag: `"a"`}, dst: storage.ObjectInfo{Size: 4, ETag: `"a"`}, want: true},
+		{name: "different etag", src: storage.ObjectInfo{Size: 4, ETag: `"a"`}, dst: storage.ObjectInfo{Size: 4, ETag: `"b"`}},
+		{name: "different size", src: storage.ObjectInfo{Size: 4, ETag: `"a"`}, dst: storage.ObjectInfo{Size: 5, ETag: `"a"`}},
+		{name: "multipart source", src: storage.ObjectInfo{Size: 4, ETag: `"a-2"`}, dst: storage.ObjectInfo{Size: 4, ETag: `"b"`}, want: true},
+		{name: "multipart target", src: storage.ObjectInfo{Size: 4, ETag: `"a"`}, dst: storage.ObjectInfo{Size: 4, ETag: `"b-3"`}, want: true},
+		{name: "multipart different size", src: storage.ObjectInfo{Size: 4, ETag: `"a-2"`}, dst: storage.ObjectInfo{Size: 3, ETag: `"a-2"`}},
+	}
+	for _, tt := range tests {
+		if got := sameObject(tt.src, tt.dst); got != tt.want {
+			t.Errorf("%s: sameObject() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
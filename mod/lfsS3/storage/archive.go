@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+type ArchiveConfig struct {
+	// Enable 下载前通过 HEAD 检查对象是否已被归档
+	Enable bool `yaml:"enable"`
+	// RestoreDays 恢复后的副本保留天数
+	RestoreDays int64 `yaml:"restoreDays"`
+	// RestoreTier 恢复速度等级：Expedited、Standard、Bulk
+	RestoreTier string `yaml:"restoreTier"`
+	// RetryAfter 建议客户端重试的间隔秒数，为 0 时根据 RestoreTier 估算
+	RetryAfter int `yaml:"retryAfter"`
+}
+
+type ArchiveStatus int
+
+type ArchiveInfo struct {
+	Status       ArchiveStatus
+	StorageClass string
+}
+
+const (
+	ArchiveStatusAvailable ArchiveStatus = iota
+	ArchiveStatusArchived
+	ArchiveStatusRestoring
+)
+
+const errCodeRestoreAlreadyInProgress = "RestoreAlreadyInProgress"
+
+// 各恢复等级的典型耗时，用于生成 Retry-After 提示
+var restoreTierRetryAfter = map[string]time.Duration{
+	s3.TierExpedited: 5 * time.Minute,
+	s3.TierStandard:  5 * time.Hour,
+	s3.TierBulk:      12 * time.Hour,
+}
+
+func (s *S3Storage) ArchiveEnabled() bool {
+	return s.clients.Load().archive.Enable
+}
+
+// GetArchiveStatus 查询对象是否处于归档存储中以及是否正在恢复
+func (s *S3Storage) GetArchiveStatus(ctx context.Context, key string) (ArchiveInfo, error) {
+	c := s.clients.Load()
+	out, err := c.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ArchiveInfo{}, errors.Wrap(err, "head object")
+	}
+	info := ArchiveInfo{
+		Status:       ArchiveStatusAvailable,
+		StorageClass: aws.StringValue(out.StorageClass),
+	}
+
+	archived := false
+	switch info.StorageClass {
+	case s3.ObjectStorageClassGlacier, s3.ObjectStorageClassDeepArchive:
+		archived = true
+	}
+	switch aws.StringValue(out.ArchiveStatus) {
+	case s3.ArchiveStatusArchiveAccess, s3.ArchiveStatusDeepArchiveAccess:
+		archived = true
+	}
+	if !archived {
+		return info, nil
+	}
+
+	// Restore 头的格式为 ongoing-request="true" 或 ongoing-request="false", expiry-date="..."
+	restore := aws.StringValue(out.Restore)
+	switch {
+	case strings.Contains(restore, `ongoing-request="true"`):
+		info.Status = ArchiveStatusRestoring
+	case strings.Contains(restore, `ongoing-request="false"`):
+		info.Status = ArchiveStatusAvailable
+	default:
+		info.Status = ArchiveStatusArchived
+	}
+	return info, nil
+}
+
+// RestoreObject 发起归档对象的恢复请求，恢复已在进行中时不返回错误
+func (s *S3Storage) RestoreObject(ctx context.Context, key string, storageClass string) error {
+	c := s.clients.Load()
+	req := &s3.RestoreRequest{}
+	// Intelligent-Tiering 归档层的对象恢复后直接回到热层，不允许指定 Days
+	if storageClass != s3.ObjectStorageClassIntelligentTiering {
+		req.Days = aws.Int64(1)
+		if c.archive.RestoreDays > 0 {
+			req.Days = aws.Int64(c.archive.RestoreDays)
+		}
+	}
+	if c.archive.RestoreTier != "" {
+		req.GlacierJobParameters = &s3.GlacierJobParameters{Tier: aws.String(c.archive.RestoreTier)}
+	}
+
+	_, err := c.client.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket:         aws.String(c.bucketName),
+		Key:            aws.String(key),
+		RestoreRequest: req,
+	})
+	if err != nil {
+		var aErr awserr.Error
+		if errors.As(err, &aErr) {
+			switch aErr.Code() {
+			case errCodeRestoreAlreadyInProgress, s3.ErrCodeObjectAlreadyInActiveTierError:
+				return nil
+			}
+		}
+		return errors.Wrap(err, "restore object")
+	}
+	return nil
+}
+
+// RestoreRetryAfter 返回建议客户端在多久之后重新请求已归档的对象
+func (s *S3Storage) RestoreRetryAfter() time.Duration {
+	c := s.clients.Load()
+	if c.archive.RetryAfter > 0 {
+		return time.Duration(c.archive.RetryAfter) * time.Second
+	}
+	if d, ok := restoreTierRetryAfter[c.archive.RestoreTier]; ok {
+		return d
+	}
+	return restoreTierRetryAfter[s3.TierStandard]
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"path"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/pointer"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/repo"
+	"github.com/pkg/errors"
+)
+
+// Layout 对象键的布局
+type Layout string
+
+const (
+	// LayoutRepo 按仓库存放：<仓库>/<OID>
+	LayoutRepo Layout = "repo"
+	// LayoutContent 按内容寻址，仓库间共享对象：.lfs-s3/objects/<OID[0:2]>/<OID[2:4]>/<OID>，
+	// 位于保留前缀下，因此不会与仓库路径冲突
+	LayoutContent Layout = "content"
+
+	contentPrefix = ReservedPrefix + "objects/"
+)
+
+// ErrNotRepoScoped 布局的键中不包含仓库，无法按仓库列举或统计对象
+var ErrNotRepoScoped = errors.New("the content layout does not record which repository an object belongs to")
+
+// ParseLayout 解析布局名称，为空时使用 LayoutRepo
+func ParseLayout(name string) (Layout, error) {
+	switch Layout(name) {
+	case "", LayoutRepo:
+		return LayoutRepo, nil
+	case LayoutContent:
+		return LayoutContent, nil
+	default:
+		return "", errors.Errorf("unknown layout %q", name)
+	}
+}
+
+// Key 返回对象在该布局下的键，oid 需要已经过校验
+func (l Layout) Key(r repo.Repo, oid string) string {
+	if l == LayoutContent {
+		return contentPrefix + oid[0:2] + "/" + oid[2:4] + "/" + oid
+	}
+	return r.String() + "/" + oid
+}
+
+// RepoScoped 键中是否包含仓库，只有这样的布局才能按仓库列举与统计对象
+func (l Layout) RepoScoped() bool {
+	return l != LayoutContent
+}
+
+// RepoPrefix 返回仓库对象所在的键前缀，前缀下还可能包含子命名空间中其他仓库的对象
+func (l Layout) RepoPrefix(r repo.Repo) (string, error) {
+	if !l.RepoScoped() {
+		return "", ErrNotRepoScoped
+	}
+	return r.String() + "/", nil
+}
+
+// Prefix 返回该布局下所有对象所在的键前缀，按仓库存放时为空，遍历时需要通过 ParseKey 过滤
+func (l Layout) Prefix() string {
+	if l == LayoutContent {
+		return contentPrefix
+	}
+	return ""
+}
+
+// ParseKey 解析该布局下对象的键，返回对象所属的仓库与 OID，按内容寻址时仓库为 nil；
+// 不属于该布局的键（例如保留前缀下的其他数据）返回 false
+func (l Layout) ParseKey(key string) (*repo.Repo, string, bool) {
+	oid := path.Base(key)
+	if !pointer.ValidOID(oid) {
+		return nil, "", false
+	}
+	if l == LayoutContent {
+		return nil, oid, key == l.Key(repo.Repo{}, oid)
+	}
+	if strings.HasPrefix(key, ReservedPrefix) {
+		return nil, "", false
+	}
+	r, err := repo.Parse(path.Dir(key))
+	if err != nil {
+		return nil, "", false
+	}
+	return &r, oid, true
+}
@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+)
+
+// ReservedPrefix 服务自身使用的键前缀（锁、健康检查等），不属于任何仓库
+const ReservedPrefix = ".lfs-s3/"
+
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrObjectExists   = errors.New("object already exists")
+)
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	StorageClass string
+}
+
+func isNotFound(err error) bool {
+	var aErr awserr.RequestFailure
+	if errors.As(err, &aErr) && aErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var codeErr awserr.Error
+	if errors.As(err, &codeErr) {
+		switch codeErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// StatObject 获取对象元信息，对象不存在时返回 ErrObjectNotFound
+func (s *S3Storage) StatObject(ctx context.Context, key string) (ObjectInfo, error) {
+	c := s.clients.Load()
+	out, err := c.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, errors.Wrap(err, "head object")
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(out.ContentLength),
+		LastModified: aws.TimeValue(out.LastModified),
+		ETag:         aws.StringValue(out.ETag),
+		StorageClass: aws.StringValue(out.StorageClass),
+	}, nil
+}
+
+// ListObjects 分页列出前缀下一级的对象（不包含更深层级的键），返回下一页的 token，没有下一页时为空
+func (s *S3Storage) ListObjects(ctx context.Context, prefix, token string, limit int64) ([]ObjectInfo, string, error) {
+	c := s.clients.Load()
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(c.bucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}
+	if token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+	if limit > 0 {
+		input.MaxKeys = aws.Int64(limit)
+	}
+	out, err := c.client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "list objects")
+	}
+
+	objects := make([]ObjectInfo, 0, len(out.Contents))
+	for _, obj := range out.Contents {
+		objects = append(objects, objectInfo(obj))
+	}
+	return objects, aws.StringValue(out.NextContinuationToken), nil
+}
+
+// WalkObjects 遍历前缀下的全部对象，fn 返回错误时停止遍历
+func (s *S3Storage) WalkObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return s.WalkObjectsAfter(ctx, prefix, "", fn)
+}
+
+// WalkObjectsAfter 按键的字典序遍历前缀下键大于 startAfter 的对象，用于中断后继续遍历
+func (s *S3Storage) WalkObjectsAfter(ctx context.Context, prefix, startAfter string, fn func(ObjectInfo) error) error {
+	c := s.clients.Load()
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucketName),
+		Prefix: aws.String(prefix),
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+	var fnErr error
+	err := c.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			if fnErr = fn(objectInfo(obj)); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return errors.Wrap(err, "list objects")
+}
+
+func objectInfo(obj *s3.Object) ObjectInfo {
+	return ObjectInfo{
+		Key:          aws.StringValue(obj.Key),
+		Size:         aws.Int64Value(obj.Size),
+		LastModified: aws.TimeValue(obj.LastModified),
+		ETag:         aws.StringValue(obj.ETag),
+		StorageClass: aws.StringValue(obj.StorageClass),
+	}
+}
+
+// GetObject 读取对象内容，调用方负责关闭返回的 ReadCloser
+func (s *S3Storage) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	c := s.clients.Load()
+	out, err := c.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, errors.Wrap(err, "get object")
+	}
+	return out.Body, nil
+}
+
+// PutObject 写入较小的对象，例如锁和元数据；exclusive 为 true 时对象已存在则返回 ErrObjectExists。
+// 不支持 If-None-Match 的存储上只能先检查再写入，并发写入同一键时可能都会成功，此时无法保证独占
+func (s *S3Storage) PutObject(ctx context.Context, key string, data []byte, exclusive bool) error {
+	c := s.clients.Load()
+	if exclusive {
+		// 并非所有 S3 兼容存储都支持 If-None-Match，先检查一次是否存在
+		if _, err := s.StatObject(ctx, key); err == nil {
+			return ErrObjectExists
+		} else if !errors.Is(err, ErrObjectNotFound) {
+			return err
+		}
+	}
+
+	req, _ := c.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	req.SetContext(ctx)
+	if exclusive {
+		req.HTTPRequest.Header.Set("If-None-Match", "*")
+	}
+	if err := req.Send(); err != nil {
+		var aErr awserr.RequestFailure
+		if errors.As(err, &aErr) && aErr.StatusCode() == http.StatusPreconditionFailed {
+			return ErrObjectExists
+		}
+		return errors.Wrap(err, "put object")
+	}
+	return nil
+}
+
+func (s *S3Storage) DeleteObject(ctx context.Context, key string) error {
+	c := s.clients.Load()
+	_, err := c.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	return errors.Wrap(err, "delete object")
+}
+
+const (
+	// maxCopySize 单次 CopyObject 支持的最大对象大小，更大的对象需要分片复制
+	maxCopySize  = 5 << 30
+	copyPartSize = 512 << 20
+)
+
+// CopyObject 将 srcBucket 中的对象复制到当前存储桶，两者可以是同一个存储桶，
+// size 超过单次复制上限时使用分片复制
+func (s *S3Storage) CopyObject(ctx context.Context, srcBucket, src, dst string, size int64) error {
+	c := s.clients.Load()
+	source := url.PathEscape(srcBucket + "/" + src)
+	var storageClass *string
+	if c.storageClass != "" {
+		storageClass = aws.String(c.storageClass)
+	}
+	if size <= maxCopySize {
+		_, err := c.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:       aws.String(c.bucketName),
+			Key:          aws.String(dst),
+			CopySource:   aws.String(source),
+			StorageClass: storageClass,
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return ErrObjectNotFound
+			}
+			return errors.Wrap(err, "copy object")
+		}
+		return nil
+	}
+
+	upload, err := c.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(c.bucketName),
+		Key:          aws.String(dst),
+		StorageClass: storageClass,
+	})
+	if err != nil {
+		return errors.Wrap(err, "create multipart upload")
+	}
+	abort := func() {
+		_, _ = c.client.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(c.bucketName),
+			Key:      aws.String(dst),
+			UploadId: upload.UploadId,
+		})
+	}
+
+	var parts []*s3.CompletedPart
+	for start, part := int64(0), int64(1); start < size; start, part = start+copyPartSize, part+1 {
+		end := min(start+copyPartSize, size) - 1
+		out, err := c.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(c.bucketName),
+			Key:             aws.String(dst),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			PartNumber:      aws.Int64(part),
+			UploadId:        upload.UploadId,
+		})
+		if err != nil {
+			abort()
+			return errors.Wrapf(err, "copy part %d", part)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int64(part)})
+	}
+
+	_, err = c.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(c.bucketName),
+		Key:             aws.String(dst),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abort()
+		return errors.Wrap(err, "complete multipart upload")
+	}
+	return nil
+}
+
+// UploadObject 以流的方式写入任意大小的对象，较大的对象会自动分片上传
+func (s *S3Storage) UploadObject(ctx context.Context, key string, body io.Reader) error {
+	c := s.clients.Load()
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if c.storageClass != "" {
+		input.StorageClass = aws.String(c.storageClass)
+	}
+	_, err := s3manager.NewUploaderWithClient(c.client).UploadWithContext(ctx, input)
+	return errors.Wrap(err, "upload object")
+}
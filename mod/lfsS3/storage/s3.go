@@ -2,19 +2,31 @@ package storage
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
+	"github.com/asjdf/lfs-s3/mod/jinx/requestid"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/pkg/metrics"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 )
 
+// S3Storage 的客户端与配置可以在运行时通过 Reload 整体替换，持有它的组件无需重新创建
 type S3Storage struct {
+	clients atomic.Pointer[s3Clients]
+}
+
+type s3Clients struct {
 	client         *s3.S3
-	ExternalClient *s3.S3
+	externalClient *s3.S3
 	bucketName     string
+	storageClass   string
+	archive        ArchiveConfig
 }
 
 type S3Config struct {
@@ -25,9 +37,21 @@ type S3Config struct {
 	BucketName       string `yaml:"bucketName"`
 	Region           string `yaml:"region"`
 	PathStyle        bool   `yaml:"pathStyle"`
+	// StorageClass 新上传对象使用的存储类型，为空时使用桶的默认存储类型
+	StorageClass string        `yaml:"storageClass"`
+	Archive      ArchiveConfig `yaml:"archive"`
 }
 
 func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	s := &S3Storage{}
+	if err := s.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload 使用新配置创建客户端并原子地替换，失败时继续使用原来的客户端
+func (s *S3Storage) Reload(cfg S3Config) error {
 	s3Config := &aws.Config{
 		Credentials:      credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
 		Endpoint:         aws.String(cfg.ExternalEndpoint),
@@ -36,8 +60,9 @@ func NewS3Storage(cfg S3Config) (*S3Storage, error) {
 	}
 	newSession, err := session.NewSession(s3Config)
 	if err != nil {
-		return nil, errors.Wrap(err, "init session")
+		return errors.Wrap(err, "init session")
 	}
+	instrumentSession(newSession)
 	eClient := s3.New(newSession)
 
 	client := eClient
@@ -50,35 +75,82 @@ func NewS3Storage(cfg S3Config) (*S3Storage, error) {
 		}
 		newSession, err = session.NewSession(s3Config)
 		if err != nil {
-			return nil, errors.Wrap(err, "init session")
+			return errors.Wrap(err, "init session")
 		}
+		instrumentSession(newSession)
 		client = s3.New(newSession)
 	}
 
-	return &S3Storage{
+	if cfg.StorageClass != "" && !lo.Contains(s3.StorageClass_Values(), cfg.StorageClass) {
+		return errors.Errorf("unsupported storage class: %s", cfg.StorageClass)
+	}
+	if cfg.Archive.RestoreTier != "" && !lo.Contains(s3.Tier_Values(), cfg.Archive.RestoreTier) {
+		return errors.Errorf("unsupported restore tier: %s", cfg.Archive.RestoreTier)
+	}
+
+	s.clients.Store(&s3Clients{
 		client:         client,
-		ExternalClient: eClient,
+		externalClient: eClient,
 		bucketName:     cfg.BucketName,
-	}, nil
+		storageClass:   cfg.StorageClass,
+		archive:        cfg.Archive,
+	})
+	return nil
+}
+
+// instrumentSession 记录每次实际发出的 S3 请求的耗时与错误，预签名不会触发 Complete 回调；
+// 同时将请求ID透传给 S3，预签名请求不携带 context，因此不会把请求ID签入URL
+func instrumentSession(sess *session.Session) {
+	sess.Handlers.Build.PushBack(func(r *request.Request) {
+		if id := requestid.FromContext(r.Context()); id != "" {
+			r.HTTPRequest.Header.Set(requestid.Header, id)
+		}
+	})
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		op := r.Operation.Name
+		metrics.S3Duration.WithLabelValues(op).Observe(time.Since(r.Time).Seconds())
+		if r.Error != nil {
+			metrics.S3Errors.WithLabelValues(op).Inc()
+		}
+	})
+}
+
+// BucketName 返回存储桶名称
+func (s *S3Storage) BucketName() string {
+	return s.clients.Load().bucketName
+}
+
+// BucketReachable 通过内部客户端 HEAD 存储桶，检查桶是否可访问
+func (s *S3Storage) BucketReachable(ctx context.Context) error {
+	c := s.clients.Load()
+	_, err := c.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(c.bucketName),
+	})
+	return errors.Wrap(err, "head bucket")
 }
 
 func (s *S3Storage) ObjectExists(ctx context.Context, key string) (bool, error) {
-	_, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s.bucketName),
+	c := s.clients.Load()
+	_, err := c.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucketName),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return false, nil
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "head object")
 	}
 	return true, nil
 }
 
 func (s *S3Storage) GetObjectDownloadURL(ctx context.Context, key string, expiresIn ...time.Duration) (string, error) {
+	c := s.clients.Load()
 	var client *s3.S3
-	if s.ExternalClient != nil {
-		client = s.ExternalClient
+	if c.externalClient != nil {
+		client = c.externalClient
 	} else {
-		client = s.client
+		client = c.client
 	}
 
 	defaultExpiresIn := 24 * time.Hour
@@ -87,7 +159,7 @@ func (s *S3Storage) GetObjectDownloadURL(ctx context.Context, key string, expire
 	}
 
 	getReq, _ := client.GetObjectRequest(&s3.GetObjectInput{
-		Bucket: aws.String(s.bucketName),
+		Bucket: aws.String(c.bucketName),
 		Key:    aws.String(key),
 	})
 	return getReq.Presign(defaultExpiresIn)
@@ -95,11 +167,12 @@ func (s *S3Storage) GetObjectDownloadURL(ctx context.Context, key string, expire
 
 // GetObjectUploadURL 生成对象的上传预签名URL
 func (s *S3Storage) GetObjectUploadURL(ctx context.Context, key string, expiresIn ...time.Duration) (string, error) {
+	c := s.clients.Load()
 	var client *s3.S3
-	if s.ExternalClient != nil {
-		client = s.ExternalClient
+	if c.externalClient != nil {
+		client = c.externalClient
 	} else {
-		client = s.client
+		client = c.client
 	}
 
 	defaultExpiresIn := 24 * time.Hour
@@ -107,9 +180,22 @@ func (s *S3Storage) GetObjectUploadURL(ctx context.Context, key string, expiresI
 		defaultExpiresIn = expiresIn[0]
 	}
 
-	putReq, _ := client.PutObjectRequest(&s3.PutObjectInput{
-		Bucket: aws.String(s.bucketName),
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(c.bucketName),
 		Key:    aws.String(key),
-	})
+	}
+	if c.storageClass != "" {
+		input.StorageClass = aws.String(c.storageClass)
+	}
+	putReq, _ := client.PutObjectRequest(input)
 	return putReq.Presign(defaultExpiresIn)
 }
+
+// UploadHeader 返回客户端上传时必须携带的请求头，这些请求头参与了预签名计算
+func (s *S3Storage) UploadHeader() map[string]string {
+	c := s.clients.Load()
+	if c.storageClass == "" {
+		return nil
+	}
+	return map[string]string{"x-amz-storage-class": c.storageClass}
+}
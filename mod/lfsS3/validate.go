@@ -0,0 +1,89 @@
+package lfsS3
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/asjdf/lfs-s3/mod/lfsS3/handler"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/quota"
+	"github.com/asjdf/lfs-s3/mod/lfsS3/storage"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// Validate 检查配置是否完整有效，返回发现的全部问题，问题以配置项的路径开头
+func (c Config) Validate() []error {
+	var errs []error
+	add := func(field string, err error) {
+		errs = append(errs, errors.Wrap(err, field))
+	}
+
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.HasSuffix(c.BasePath, "/")) {
+		add("basePath", errors.Errorf("%q must start with / and must not end with /", c.BasePath))
+	}
+
+	if c.S3.BucketName == "" {
+		add("s3.bucketName", errors.New("is required"))
+	}
+	if c.S3.Region == "" {
+		add("s3.region", errors.New("is required, e.g. us-east-1"))
+	}
+	if c.S3.ExternalEndpoint == "" {
+		add("s3.externalEndpoint", errors.New("is required, it is used in presigned URLs returned to clients"))
+	} else if err := validateEndpoint(c.S3.ExternalEndpoint); err != nil {
+		add("s3.externalEndpoint", err)
+	}
+	if c.S3.Endpoint != "" {
+		if err := validateEndpoint(c.S3.Endpoint); err != nil {
+			add("s3.endpoint", err)
+		}
+	}
+	if (c.S3.AccessKeyID == "") != (c.S3.SecretAccessKey == "") {
+		add("s3.accessKeyID", errors.New("must be set together with s3.secretAccessKey"))
+	}
+	if tier := c.S3.Archive.RestoreTier; tier != "" && !lo.Contains(s3.Tier_Values(), tier) {
+		add("s3.archive.restoreTier", errors.Errorf("%q is not one of %s", tier, strings.Join(s3.Tier_Values(), ", ")))
+	}
+
+	if _, err := quota.NewTracker(c.Quota, nil); err != nil {
+		add("quota", err)
+	}
+	if _, err := handler.NewLimits(c.Limits); err != nil {
+		add("limits", err)
+	}
+	if layout, err := storage.ParseLayout(c.Layout.Name); err != nil {
+		add("layout.name", err)
+	} else if err := checkQuotaLayout(c.Quota, layout); err != nil {
+		add("quota.enable", err)
+	}
+	if c.Layout.Previous.Name != "" {
+		if _, err := storage.ParseLayout(c.Layout.Previous.Name); err != nil {
+			add("layout.previous.name", err)
+		}
+	}
+	return errs
+}
+
+// checkQuotaLayout 配额按键中的仓库统计用量，只支持按仓库存放的布局
+func checkQuotaLayout(cfg quota.Config, layout storage.Layout) error {
+	if cfg.Enable && !layout.RepoScoped() {
+		return errors.Wrapf(storage.ErrNotRepoScoped, "quota requires the %s layout", storage.LayoutRepo)
+	}
+	return nil
+}
+
+// validateEndpoint 检查 S3 地址是否为带主机名的 http(s) 地址
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return errors.Errorf("%q is not a valid URL", endpoint)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("%q must be an absolute http(s) URL, e.g. https://s3.example.com", endpoint)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return errors.Errorf("%q must not contain a path, the bucket is set by bucketName", endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Package envconf overrides module configs with environment variables.
+//
+// Every field of a module config can be set by a variable named after the
+// module and the yaml keys leading to the field, with camelCase converted to
+// UPPER_SNAKE_CASE and joined by underscores, e.g. lfsS3.s3.secretAccessKey
+// becomes LFS_S3_S3_SECRET_ACCESS_KEY. Appending _FILE reads the value from
+// the named file instead, which suits secrets mounted into containers.
+package envconf
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/juanjiTech/jframe/core/kernel"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// FileSuffix marks variables whose value is the path of a file holding the
+// actual value.
+const FileSuffix = "_FILE"
+
+// ApplyModules applies overrides to the config of every module that has one.
+func ApplyModules(v *viper.Viper, mods ...kernel.Module) error {
+	for _, mod := range mods {
+		if mod.Config() == nil {
+			continue
+		}
+		if err := Apply(v, mod.Name(), mod.Config()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply merges the overrides found in the environment into v under key.
+// config is only used to enumerate the fields and is left untouched, so it
+// must be unmarshalled from v afterwards.
+func Apply(v *viper.Viper, key string, config any) error {
+	overrides := map[string]any{}
+	var walkErr error
+	walk(reflect.TypeOf(config), nil, func(path []string, t reflect.Type) {
+		if walkErr != nil {
+			return
+		}
+		name := Name(append([]string{key}, path...)...)
+		raw, ok, err := lookup(name)
+		if err != nil {
+			walkErr = err
+			return
+		}
+		if !ok {
+			return
+		}
+		value, err := parse(raw, t)
+		if err != nil {
+			walkErr = errors.Wrap(err, name)
+			return
+		}
+		set(overrides, path, value)
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+	if len(overrides) == 0 {
+		return nil
+	}
+	// MergeConfigMap keeps the values from the file that are not overridden,
+	// unlike Set which shadows the whole subtree when unmarshalling by key.
+	return errors.Wrap(v.MergeConfigMap(map[string]any{key: overrides}), "merge env overrides")
+}
+
+// Name returns the variable name for the given config key path.
+func Name(path ...string) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = snake(p)
+	}
+	return strings.Join(parts, "_")
+}
+
+// walk calls fn for every leaf field reachable from t through yaml keys.
+func walk(t reflect.Type, path []string, fn func(path []string, t reflect.Type)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		fn(path, t)
+		return
+	}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		walk(f.Type, append(path[:len(path):len(path)], tag), fn)
+	}
+}
+
+// lookup reads the variable itself or, if unset, the file named by its
+// _FILE variant.
+func lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	file, fileOK := os.LookupEnv(name + FileSuffix)
+	switch {
+	case ok && fileOK:
+		return "", false, errors.Errorf("both %s and %s are set", name, name+FileSuffix)
+	case ok:
+		return value, true, nil
+	case fileOK:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "read %s", name+FileSuffix)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// parse converts the raw value for a field of type t. Scalars are left as
+// strings and converted when unmarshalling; lists of scalars are comma
+// separated, other lists and maps are written in YAML flow style.
+func parse(raw string, t reflect.Type) (any, error) {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() != reflect.Struct && !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			if strings.TrimSpace(raw) == "" {
+				return []string{}, nil
+			}
+			items := strings.Split(raw, ",")
+			for i := range items {
+				items[i] = strings.TrimSpace(items[i])
+			}
+			return items, nil
+		}
+	case reflect.Map:
+	default:
+		return raw, nil
+	}
+	var value any
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, errors.Wrap(err, "parse yaml")
+	}
+	return value, nil
+}
+
+func set(m map[string]any, path []string, value any) {
+	for _, p := range path[:len(path)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
+
+// snake converts camelCase to UPPER_SNAKE_CASE, keeping acronyms together:
+// clientCAFile becomes CLIENT_CA_FILE and lfsS3 becomes LFS_S3.
+func snake(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
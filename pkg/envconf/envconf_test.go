@@ -0,0 +1,153 @@
+package envconf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{path: []string{"lfsS3", "s3", "secretAccessKey"}, want: "LFS_S3_S3_SECRET_ACCESS_KEY"},
+		{path: []string{"jinx", "tls", "clientCAFile"}, want: "JINX_TLS_CLIENT_CA_FILE"},
+		{path: []string{"jinx", "tls", "minVersion"}, want: "JINX_TLS_MIN_VERSION"},
+		{path: []string{"sentryDsn"}, want: "SENTRY_DSN"},
+		{path: []string{"grpcx", "enable"}, want: "GRPCX_ENABLE"},
+		{path: []string{"lfsS3", "limits", "maxObjectSize"}, want: "LFS_S3_LIMITS_MAX_OBJECT_SIZE"},
+		{path: []string{"HTTPPort"}, want: "HTTP_PORT"},
+	}
+	for _, tt := range tests {
+		if got := Name(tt.path...); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+type testConfig struct {
+	Enable    bool     `yaml:"enable"`
+	BasePath  string   `yaml:"basePath"`
+	Origins   []string `yaml:"origins"`
+	Ignored   string   `yaml:"-"`
+	unexposed string
+	S3        struct {
+		Bucket          string `yaml:"bucketName"`
+		SecretAccessKey string `yaml:"secretAccessKey"`
+	} `yaml:"s3"`
+	Repos []struct {
+		Repo     string `yaml:"repo"`
+		MaxBytes int64  `yaml:"maxBytes"`
+	} `yaml:"repos"`
+}
+
+func newViper(t *testing.T) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader("app:\n  basePath: /lfs\n  s3:\n    bucketName: bucket\n    secretAccessKey: file\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestApply(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[string]any
+	}{
+		{
+			name: "no overrides",
+			want: map[string]any{"app.basePath": "/lfs", "app.s3.secretAccessKey": "file", "app.enable": nil},
+		},
+		{
+			name: "scalars",
+			env:  map[string]string{"APP_ENABLE": "true", "APP_S3_SECRET_ACCESS_KEY": "env"},
+			want: map[string]any{"app.enable": "true", "app.s3.secretAccessKey": "env", "app.s3.bucketName": "bucket"},
+		},
+		{
+			name: "file",
+			env:  map[string]string{"APP_S3_SECRET_ACCESS_KEY_FILE": secret},
+			want: map[string]any{"app.s3.secretAccessKey": "from-file", "app.basePath": "/lfs"},
+		},
+		{
+			name: "comma separated list",
+			env:  map[string]string{"APP_ORIGINS": "https://a.example.com, https://b.example.com"},
+			want: map[string]any{"app.origins": []string{"https://a.example.com", "https://b.example.com"}},
+		},
+		{
+			name: "empty list",
+			env:  map[string]string{"APP_ORIGINS": ""},
+			want: map[string]any{"app.origins": []string{}},
+		},
+		{
+			name: "flow style list",
+			env:  map[string]string{"APP_REPOS": "[{repo: owner/name, maxBytes: 10}]"},
+			// viper lowercases keys, the same as for values read from the file
+			want: map[string]any{"app.repos": []any{map[string]any{"repo": "owner/name", "maxbytes": 10}}},
+		},
+		{
+			name: "ignored fields",
+			env:  map[string]string{"APP_IGNORED": "x", "APP_UNEXPOSED": "x"},
+			want: map[string]any{"app.ignored": nil, "app.unexposed": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			v := newViper(t)
+			if err := Apply(v, "app", &testConfig{}); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				if got := v.Get(key); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{
+			name: "both value and file",
+			env:  map[string]string{"APP_BASE_PATH": "/a", "APP_BASE_PATH_FILE": "/dev/null"},
+		},
+		{
+			name: "missing file",
+			env:  map[string]string{"APP_BASE_PATH_FILE": filepath.Join(t.TempDir(), "missing")},
+		},
+		{
+			name: "invalid yaml",
+			env:  map[string]string{"APP_REPOS": "[{repo: "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if err := Apply(newViper(t), "app", &testConfig{}); err == nil {
+				t.Error("Apply() succeeded, want error")
+			}
+		})
+	}
+}